@@ -7,11 +7,15 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	commandhandler "github.com/amus-sal/kth-datacloud-csv-converter/command-handler"
 	"github.com/amus-sal/kth-datacloud-csv-converter/connection"
+	"github.com/amus-sal/kth-datacloud-csv-converter/converter"
 	"github.com/amus-sal/kth-datacloud-csv-converter/event"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -29,9 +33,67 @@ type rabbitSecret struct {
 }
 
 func main() {
+	// Compression of the columns of written Parquet files.
+	compression := envString("PARQUET_COMPRESSION", converter.DefaultCompression)
+	if _, ok := converter.Compressions[compression]; !ok {
+		log.Fatalf("unknown parquet compression %q", compression)
+	}
+
+	// Format of the schemas written next to converted files.
+	schemaFormat := envString("SCHEMA_FORMAT", converter.DefaultSchemaFormat)
+	if _, ok := converter.SchemaFormats[schemaFormat]; !ok {
+		log.Fatalf("unknown schema format %q", schemaFormat)
+	}
+
+	// Converted files are written to a directory per run and event under the output directory, which is
+	// shared with the next steps. Runs are told apart by the name of their pod unless given an ID.
+	outputDir := envString("OUTPUT_DIR", ".")
+	runID := envString("RUN_ID", "")
+	if runID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Fatal(err)
+		}
+		runID = hostname
+	}
+
+	// Converters between the supported formats, keyed by input and output format.
+	converters := converter.NewRegistry(
+		converter.WithSampleSize(int(envInt("DIALECT_SAMPLE_BYTES", converter.DefaultSampleSize))),
+		converter.WithRowGroupSize(envInt("PARQUET_ROW_GROUP_BYTES", converter.DefaultRowGroupSize)),
+		converter.WithCompression(compression),
+		converter.WithSchemaFormat(schemaFormat),
+	)
+
+	// CLI mode for workflow steps, a failed conversion exits with a non-zero code.
 	if len(os.Args) > 1 {
 		file := os.Args[1]
-		commandhandler.Handle(file)
+		options := converter.Options{
+			Input:          converter.Format(envString("INPUT_FORMAT", "")),
+			Output:         converter.Format(envString("OUTPUT_FORMAT", string(converter.FormatCSV))),
+			Delimiter:      envString("DELIMITER", ""),
+			Sheet:          envString("SHEET", ""),
+			AllSheets:      envBool("ALL_SHEETS", false),
+			SchemaSample:   int(envInt("SCHEMA_SAMPLE_ROWS", 0)),
+			Arrays:         envString("ARRAYS", ""),
+			ArraySeparator: envString("ARRAY_SEPARATOR", ""),
+		}
+		// Column types are given as name:type pairs separated by commas.
+		if value := envString("COLUMN_TYPES", ""); value != "" {
+			options.ColumnTypes = map[string]converter.ColumnType{}
+			for _, pair := range strings.Split(value, ",") {
+				name, t, _ := strings.Cut(pair, ":")
+				options.ColumnTypes[strings.TrimSpace(name)] = converter.ColumnType(strings.TrimSpace(t))
+			}
+		}
+		dest, err := converter.OutputPath(outputDir, runID, envString("EVENT_ID", filepath.Base(file)), options.Output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := commandhandler.Handle(file, dest, options, converters); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 		os.Exit(0)
 	}
 	const serviceName = "csv-converter-api"
@@ -95,6 +157,8 @@ func main() {
 	// Event service receives async events and handles the corresponding business logic.
 	eventService := event.NewService(
 		publisher,
+		converters,
+		event.WithOutput(outputDir, runID),
 	)
 
 	//AMQP connector and consumer connected to RabbitMQ.
@@ -136,3 +200,21 @@ func envString(key string, fallback string) string {
 	}
 	return fallback
 }
+
+func envInt(key string, fallback int64) int64 {
+	if value, ok := syscall.Getenv(key); ok {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	}
+	return fallback
+}
+
+func envBool(key string, fallback bool) bool {
+	if value, ok := syscall.Getenv(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
@@ -1,75 +1,42 @@
 package commandhandler
 
 import (
-	"bufio"
-	"encoding/csv"
+	"context"
+	"encoding/json"
 	"fmt"
-	"log"
 	"os"
-	"strings"
-)
-
-
-
-func Handle(path string) {
-
-	dest, err := csvConverter(path)
-	if err != nil {
-		fmt.Println(er r)
-	}
-	f, err := os.Create("/tmp/output.txt")
-
-	if err != nil {
-		log.Fatal(err)
-	}
+	"path/filepath"
 
-	defer f.Close()
+	"github.com/amus-sal/kth-datacloud-csv-converter/converter"
+)
 
-	_, err = f.WriteString(dest)
+// outputPath is read by Argo as the output parameter of the step, it holds the paths of the converted files
+// as a JSON array, so the next steps can fan out over them.
+const outputPath = "/tmp/output.txt"
 
-	if err != nil {
-		log.Fatal(err)
-	}
+type converters interface {
+	ConvertFile(ctx context.Context, source, destination string, options converter.Options) ([]converter.Result, error)
 }
 
-func csvConverter(tsvFileSource string) (string, error) {
-	// Open the TSV file for reading
-	tsvFile, err := os.Open(tsvFileSource)
+// Handle converts the file at path into dest in the output format of the options and writes
+// the paths of the converted files to the output file. The directory of dest is removed when the
+// conversion fails, so no files of an earlier attempt at the step are left for the next steps.
+func Handle(path, dest string, options converter.Options, converters converters) error {
+	results, err := converters.ConvertFile(context.Background(), path, dest, options)
 	if err != nil {
-		return "", err
+		if rmErr := os.RemoveAll(filepath.Dir(dest)); rmErr != nil {
+			return fmt.Errorf("%w, cleanup failed: %v", err, rmErr)
+		}
+		return err
 	}
-	defer tsvFile.Close()
 
-	// Create a CSV file for writing
-	csvFile, err := os.Create("file.csv")
-	if err != nil {
-		return "", err
+	paths := make([]string, len(results))
+	for i, result := range results {
+		paths[i] = result.Path
 	}
-	defer csvFile.Close()
-
-	// Create CSV writer
-	csvWriter := csv.NewWriter(csvFile)
-	defer csvWriter.Flush()
-
-	// Create a TSV reader
-	tsvReader := bufio.NewReader(tsvFile)
-
-	for {
-		// Read a line from the TSV file
-		line, err := tsvReader.ReadString('\n')
-		if err != nil {
-			fmt.Println(err)
-			break
-		}
-
-		// Split the TSV line by tabs
-		fields := strings.Split(strings.TrimSpace(line), "\t")
-
-		// Write the fields to the CSV file
-		err = csvWriter.Write(fields)
-		if err != nil {
-			return "", err
-		}
+	b, err := json.Marshal(paths)
+	if err != nil {
+		return err
 	}
-	return "./file.csv", nil
+	return os.WriteFile(outputPath, b, 0644)
 }
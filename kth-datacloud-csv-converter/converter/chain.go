@@ -0,0 +1,101 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+// encoder writes CSV in another format.
+type encoder interface {
+	// Encode writes the CSV read from r, which is read twice, in the output format. Header tells
+	// whether the first record names the columns. The result counts the records written and holds
+	// the schema of typed output.
+	Encode(ctx context.Context, r io.ReadSeeker, w io.Writer, header bool, options Options) (Result, error)
+}
+
+// chained converts input into CSV and encodes the CSV in the output format, so every input converted
+// into CSV can be converted into every output with an encoder. The CSV is kept in a hidden temporary
+// file in the temporary directory of the options.
+type chained struct {
+	csv     Converter
+	encoder encoder
+}
+
+func (c chained) Convert(ctx context.Context, r io.Reader, w io.Writer, options Options) (Result, error) {
+	tmp, err := os.CreateTemp(options.tempDir, ".csv-converter-*.csv")
+	if err != nil {
+		return Result{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	result, err := c.csv.Convert(ctx, r, tmp, options)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return c.encode(ctx, tmp, w, result, options)
+}
+
+func (c chained) ConvertSheets(ctx context.Context, r io.Reader, create func(sheet string) (io.Writer, error), options Options) ([]Result, error) {
+	sc, ok := c.csv.(SheetConverter)
+	if !ok {
+		return nil, fmt.Errorf("%q input has no sheets: %w", options.Input, domain.ErrBadRequest)
+	}
+
+	var (
+		files  []*os.File
+		sheets []string
+	)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	results, err := sc.ConvertSheets(ctx, r, func(sheet string) (io.Writer, error) {
+		tmp, err := os.CreateTemp(options.tempDir, ".csv-converter-*.csv")
+		if err != nil {
+			return nil, err
+		}
+		files, sheets = append(files, tmp), append(sheets, sheet)
+		return tmp, nil
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, tmp := range files {
+		w, err := create(sheets[i])
+		if err != nil {
+			return nil, err
+		}
+		if results[i], err = c.encode(ctx, tmp, w, results[i], options); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// encode encodes the CSV written to tmp, described by result, into w.
+func (c chained) encode(ctx context.Context, tmp *os.File, w io.Writer, result Result, options Options) (Result, error) {
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return Result{}, err
+	}
+
+	// Sheets have no dialect, their first row is taken as a header.
+	header := result.Dialect == nil || result.Dialect.Header
+
+	encoded, err := c.encoder.Encode(ctx, tmp, w, header, options)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result.Format, result.RowsWritten, result.Schema = encoded.Format, encoded.RowsWritten, encoded.Schema
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pathEncoder copies the CSV and keeps the path of the file it is read from.
+type pathEncoder struct {
+	path *string
+}
+
+func (e pathEncoder) Encode(ctx context.Context, r io.ReadSeeker, w io.Writer, header bool, options Options) (Result, error) {
+	*e.path = r.(*os.File).Name()
+	_, err := io.Copy(w, r)
+	return Result{Format: options.Output}, err
+}
+
+func TestChainedTempDir(t *testing.T) {
+	dir := t.TempDir()
+
+	var path string
+	c := chained{csv: delimitedConverter{delimiter: '\t', sampleSize: DefaultSampleSize}, encoder: pathEncoder{path: &path}}
+
+	var out bytes.Buffer
+	_, err := c.Convert(context.Background(), strings.NewReader("a\tb\n1\t2\n"), &out, Options{Input: FormatTSV, tempDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Dir(path) != dir || !strings.HasPrefix(filepath.Base(path), ".") {
+		t.Errorf("expected the CSV to be a hidden file in %s, got = %s", dir, path)
+	}
+	if out.String() != "a,b\n1,2\n" {
+		t.Errorf("expected output to be = %q, got = %q", "a,b\n1,2\n", out.String())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no files to be left, got = %d", len(entries))
+	}
+}
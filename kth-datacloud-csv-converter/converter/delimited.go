@@ -0,0 +1,118 @@
+package converter
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxRagged is the maximum number of ragged records listed in the result.
+const maxRagged = 100
+
+// delimitedConverter converts quoted delimited text, such as CSV, into CSV.
+type delimitedConverter struct {
+	// delimiter is the usual delimiter of the format, zero when the format has none.
+	delimiter rune
+
+	// sampleSize is the number of bytes the dialect is detected from.
+	sampleSize int
+}
+
+func (c delimitedConverter) Convert(ctx context.Context, r io.Reader, w io.Writer, options Options) (Result, error) {
+	br, encoding, err := decodeText(r, c.sampleSize)
+	if err != nil {
+		return Result{}, err
+	}
+
+	dialect, err := detectDialect(br, c.sampleSize, c.delimiter, options)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result, err := convertRecords(ctx, newTextReader(br, dialect), w, options)
+	result.Dialect, result.Encoding = &dialect, encoding
+	return result, err
+}
+
+// tsvConverter converts tab separated text into CSV. Input that turns out to be
+// separated by another delimiter is converted as quoted delimited text instead.
+type tsvConverter struct {
+	// sampleSize is the number of bytes the dialect is detected from.
+	sampleSize int
+}
+
+func (c tsvConverter) Convert(ctx context.Context, r io.Reader, w io.Writer, options Options) (Result, error) {
+	br, encoding, err := decodeText(r, c.sampleSize)
+	if err != nil {
+		return Result{}, err
+	}
+
+	dialect, err := detectDialect(br, c.sampleSize, '\t', options)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var reader recordReader = newTextReader(br, dialect)
+	if dialect.Delimiter == "\t" {
+		// Tab separated text has no quoting, it escapes with backslashes.
+		dialect.Quote, dialect.Escape = "", EscapeBackslash
+		reader = newTSVReader(br, dialect)
+	}
+
+	result, err := convertRecords(ctx, reader, w, options)
+	result.Dialect, result.Encoding = &dialect, encoding
+	return result, err
+}
+
+// convertRecords writes the records read from reader as CSV. Blank lines are read but not written,
+// records with another number of fields than the first one are written and listed as ragged.
+func convertRecords(ctx context.Context, reader recordReader, w io.Writer, options Options) (Result, error) {
+	result := Result{Format: FormatCSV}
+	writer := csv.NewWriter(w)
+	fields := -1
+	for {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to read %s input at line %d: %w", options.Input, reader.Line(), err)
+		}
+
+		result.RowsRead++
+		if blank(record) {
+			continue
+		}
+
+		if fields == -1 {
+			fields = len(record)
+		} else if len(record) != fields {
+			result.RaggedRows++
+			if len(result.Ragged) < maxRagged {
+				result.Ragged = append(result.Ragged, Ragged{Line: reader.Line(), Fields: len(record), Expected: fields})
+			}
+		}
+
+		if err := writer.Write(record); err != nil {
+			return Result{}, err
+		}
+		result.RowsWritten++
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// blank reports whether record was read from a blank line.
+func blank(record []string) bool {
+	return len(record) == 1 && record[0] == ""
+}
@@ -0,0 +1,285 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultSampleSize is the number of bytes from the start of the input the dialect is detected from.
+const DefaultSampleSize = 64 << 10 // 64 KiB.
+
+// maxSampleRecords is the maximum number of records of the sample used to detect the dialect.
+const maxSampleRecords = 100
+
+const (
+	// EscapeDouble escapes a quote inside a quoted field with another quote, as in RFC 4180.
+	EscapeDouble = "double"
+
+	// EscapeBackslash escapes a quote inside a quoted field with a backslash.
+	EscapeBackslash = "backslash"
+)
+
+// Dialect is the way delimited text is written.
+type Dialect struct {
+	Delimiter string `json:"delimiter"`
+
+	// Quote is the character fields are quoted with, empty when fields are never quoted.
+	Quote string `json:"quote,omitempty"`
+
+	// Escape is how quotes inside quoted fields are escaped, either EscapeDouble or EscapeBackslash.
+	Escape string `json:"escape,omitempty"`
+
+	// LineTerminator is the end of a line, either "\n", "\r\n" or "\r".
+	LineTerminator string `json:"line_terminator"`
+
+	// Header reports whether the first record names the columns.
+	Header bool `json:"header"`
+}
+
+// candidates are the delimiters that are detected, in order of preference.
+var candidates = []rune{',', '\t', ';', '|'}
+
+// quotes are the quote characters that are detected, in order of preference.
+var quotes = []rune{'"', '\''}
+
+// detectDialect detects the dialect of the delimited text read from br from a sample of sampleSize bytes.
+// The delimiter of the options is taken as is, otherwise fallback wins when delimiters are equally likely.
+func detectDialect(br *bufio.Reader, sampleSize int, fallback rune, options Options) (Dialect, error) {
+	sample, err := br.Peek(sampleSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return Dialect{}, err
+	}
+	complete := errors.Is(err, io.EOF)
+
+	delimiter, err := options.delimiter()
+	if err != nil {
+		return Dialect{}, err
+	}
+
+	switch {
+	case delimiter != 0:
+		return sniff(sample, complete, []rune{delimiter}), nil
+	case fallback != 0:
+		return sniff(sample, complete, preferring(fallback)), nil
+	default:
+		return sniff(sample, complete, candidates), nil
+	}
+}
+
+// sniff detects the dialect of sample among the delimiters, the first one is taken
+// when the sample does not tell them apart.
+func sniff(sample []byte, complete bool, delimiters []rune) Dialect {
+	if !complete {
+		// The last line was most likely cut off by the sample size.
+		if i := bytes.LastIndexAny(sample, "\r\n"); i > 0 {
+			sample = sample[:i+1]
+		}
+	}
+
+	dialect := Dialect{
+		Delimiter:      string(delimiters[0]),
+		Quote:          string(detectQuote(sample, delimiters)),
+		Escape:         EscapeDouble,
+		LineTerminator: lineTerminator(sample),
+	}
+	if bytes.Contains(sample, []byte(`\`+dialect.Quote)) {
+		dialect.Escape = EscapeBackslash
+	}
+
+	best := -1.0
+	var records [][]string
+	for _, delimiter := range delimiters {
+		candidate := dialect
+		candidate.Delimiter = string(delimiter)
+
+		rows := sampleRecords(sample, candidate)
+		if score := consistency(rows); score > best {
+			dialect.Delimiter, best, records = candidate.Delimiter, score, rows
+		}
+	}
+
+	dialect.Header = hasHeader(records)
+	return dialect
+}
+
+// preferring returns the candidate delimiters with delimiter first.
+func preferring(delimiter rune) []rune {
+	delimiters := []rune{delimiter}
+	for _, d := range candidates {
+		if d != delimiter {
+			delimiters = append(delimiters, d)
+		}
+	}
+	return delimiters
+}
+
+// lineTerminator returns the first line terminator of sample, a line feed when there is none.
+func lineTerminator(sample []byte) string {
+	i := bytes.IndexAny(sample, "\r\n")
+	switch {
+	case i < 0 || sample[i] == '\n':
+		return "\n"
+	case i+1 < len(sample) && sample[i+1] == '\n':
+		return "\r\n"
+	default:
+		return "\r"
+	}
+}
+
+// detectQuote returns the quote character that starts and ends the most fields of sample,
+// a double quote when no field is quoted.
+func detectQuote(sample []byte, delimiters []rune) rune {
+	boundary := func(r rune) bool {
+		for _, d := range delimiters {
+			if r == d {
+				return true
+			}
+		}
+		return r == '\n' || r == '\r'
+	}
+
+	quote, most := quotes[0], 0
+	for _, q := range quotes {
+		count, previous := 0, '\n'
+		text := string(sample)
+		for i, r := range text {
+			if r == q {
+				next, _ := utf8.DecodeRuneInString(text[i+utf8.RuneLen(r):])
+				// A quote opens a field after a boundary and closes it before one.
+				if boundary(previous) || next == utf8.RuneError || boundary(next) {
+					count++
+				}
+			}
+			previous = r
+		}
+
+		if count > most {
+			quote, most = q, count
+		}
+	}
+
+	return quote
+}
+
+// sampleRecords returns the records of the sample read in dialect, at most maxSampleRecords.
+func sampleRecords(sample []byte, dialect Dialect) [][]string {
+	reader := newTextReader(bufio.NewReader(bytes.NewReader(sample)), dialect)
+
+	var records [][]string
+	for len(records) < maxSampleRecords {
+		record, err := reader.Read()
+		if err != nil {
+			break
+		}
+		if !blank(record) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// consistency returns the share of records having the most common number of fields,
+// zero when that number is one, since then the delimiter does not split anything.
+func consistency(records [][]string) float64 {
+	counts := map[int]int{}
+	for _, record := range records {
+		counts[len(record)]++
+	}
+
+	fields, most := 0, 0
+	for n, count := range counts {
+		if count > most || (count == most && n > fields) {
+			fields, most = n, count
+		}
+	}
+
+	if fields < 2 {
+		return 0
+	}
+	return float64(most) / float64(len(records))
+}
+
+// hasHeader reports whether the first record names the columns of the others. Every column votes:
+// a header that is text above numbers, or of another length than values of a fixed length, is a name.
+// Without votes, a first record of distinct non-empty values is taken as a header.
+func hasHeader(records [][]string) bool {
+	if len(records) == 0 {
+		return false
+	}
+
+	header, rows := records[0], records[1:]
+	votes := 0
+	for i, name := range header {
+		var values []string
+		for _, row := range rows {
+			if i < len(row) && row[i] != "" {
+				values = append(values, row[i])
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		switch {
+		case allNumeric(values):
+			if isNumeric(name) {
+				votes--
+			} else {
+				votes++
+			}
+		case sameLength(values):
+			if utf8.RuneCountInString(name) == utf8.RuneCountInString(values[0]) {
+				votes--
+			} else {
+				votes++
+			}
+		}
+	}
+
+	if votes != 0 {
+		return votes > 0
+	}
+
+	seen := map[string]bool{}
+	for _, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] || isNumeric(name) {
+			return false
+		}
+		seen[name] = true
+	}
+	return true
+}
+
+// isNumeric reports whether value is a number, with either a decimal point or a decimal comma.
+func isNumeric(value string) bool {
+	value = strings.TrimSpace(value)
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	return err == nil
+}
+
+func allNumeric(values []string) bool {
+	for _, value := range values {
+		if !isNumeric(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameLength(values []string) bool {
+	for _, value := range values {
+		if utf8.RuneCountInString(value) != utf8.RuneCountInString(values[0]) {
+			return false
+		}
+	}
+	return true
+}
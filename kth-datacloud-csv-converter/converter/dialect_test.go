@@ -0,0 +1,150 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name     string
+		sample   string
+		complete bool
+		expected Dialect
+	}{
+		{
+			name:     "comma separated",
+			sample:   "name,city\nAda,London\nAlan,Wilmslow\n",
+			complete: true,
+			expected: Dialect{Delimiter: ",", Quote: `"`, Escape: EscapeDouble, LineTerminator: "\n", Header: true},
+		},
+		{
+			name:     "semicolon separated with decimal commas, as exported by Swedish Excel",
+			sample:   "Namn;Belopp;Antal\r\nÅsa;1234,50;3\r\nGöran;99,95;12\r\n",
+			complete: true,
+			expected: Dialect{Delimiter: ";", Quote: `"`, Escape: EscapeDouble, LineTerminator: "\r\n", Header: true},
+		},
+		{
+			name:     "tab separated",
+			sample:   "id\tvalue\n1\t10\n2\t20\n",
+			complete: true,
+			expected: Dialect{Delimiter: "\t", Quote: `"`, Escape: EscapeDouble, LineTerminator: "\n", Header: true},
+		},
+		{
+			name:     "pipe separated with quoted delimiters",
+			sample:   "a|b\n\"x|y\"|1\n\"z\"|2\n",
+			complete: true,
+			expected: Dialect{Delimiter: "|", Quote: `"`, Escape: EscapeDouble, LineTerminator: "\n", Header: true},
+		},
+		{
+			name:     "single quotes escaped with backslashes",
+			sample:   "name,quote\n'Ada','It\\'s'\n'Alan','Hi'\n",
+			complete: true,
+			expected: Dialect{Delimiter: ",", Quote: "'", Escape: EscapeBackslash, LineTerminator: "\n", Header: true},
+		},
+		{
+			name:     "no header",
+			sample:   "1,2\n3,4\n5,6\n",
+			complete: true,
+			expected: Dialect{Delimiter: ",", Quote: `"`, Escape: EscapeDouble, LineTerminator: "\n"},
+		},
+		{
+			name:     "last line cut off by the sample",
+			sample:   "a;b\n1;2\n3;4\n5,5",
+			expected: Dialect{Delimiter: ";", Quote: `"`, Escape: EscapeDouble, LineTerminator: "\n", Header: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialect := sniff([]byte(tt.sample), tt.complete, candidates)
+			if dialect != tt.expected {
+				t.Errorf("expected dialect to be = %+v, got = %+v", tt.expected, dialect)
+			}
+		})
+	}
+}
+
+func TestDetectDialect(t *testing.T) {
+	tests := []struct {
+		name              string
+		input             string
+		fallback          rune
+		options           Options
+		expectedDelimiter string
+		expectedErr       error
+	}{
+		{name: "detected", input: "a;b\n1;2\n", expectedDelimiter: ";"},
+		{name: "fallback when undecided", input: "a\n1\n", fallback: '\t', expectedDelimiter: "\t"},
+		{name: "delimiter of the options", input: "a;b,c\n1;2,3\n", options: Options{Delimiter: ","}, expectedDelimiter: ","},
+		{name: "invalid delimiter", input: "a,b\n", options: Options{Delimiter: `"`}, expectedErr: domain.ErrBadRequest},
+		{name: "delimiter of several characters", input: "a,b\n", options: Options{Delimiter: ",;"}, expectedErr: domain.ErrBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReader(strings.NewReader(tt.input))
+			dialect, err := detectDialect(br, DefaultSampleSize, tt.fallback, tt.options)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err == nil && dialect.Delimiter != tt.expectedDelimiter {
+				t.Errorf("expected delimiter to be = %q, got = %q", tt.expectedDelimiter, dialect.Delimiter)
+			}
+		})
+	}
+}
+
+func TestDelimitedConvert(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            string
+		format           Format
+		expected         string
+		expectedDialect  Dialect
+		expectedEncoding string
+	}{
+		{
+			name:             "Swedish Excel export in Windows-1252",
+			input:            "Namn;Belopp;Anteckning\r\n\xc5sa;1234,50;\"Betald; \x80\"\r\nG\xf6ran;99,95;\r\n",
+			format:           FormatCSV,
+			expected:         "Namn,Belopp,Anteckning\nÅsa,\"1234,50\",Betald; €\nGöran,\"99,95\",\n",
+			expectedDialect:  Dialect{Delimiter: ";", Quote: `"`, Escape: EscapeDouble, LineTerminator: "\r\n", Header: true},
+			expectedEncoding: EncodingWindows1252,
+		},
+		{
+			name:             "quoted fields with doubled quotes and line breaks",
+			input:            "id,text\n1,\"say \"\"hi\"\"\"\n2,\"two\nlines\"\n",
+			format:           FormatCSV,
+			expected:         "id,text\n1,\"say \"\"hi\"\"\"\n2,\"two\nlines\"\n",
+			expectedDialect:  Dialect{Delimiter: ",", Quote: `"`, Escape: EscapeDouble, LineTerminator: "\n", Header: true},
+			expectedEncoding: EncodingUTF8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			c := delimitedConverter{delimiter: delimiters[tt.format], sampleSize: DefaultSampleSize}
+			result, err := c.Convert(context.Background(), strings.NewReader(tt.input), &out, Options{Input: tt.format})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("expected output to be = %q, got = %q", tt.expected, out.String())
+			}
+			if result.Dialect == nil || *result.Dialect != tt.expectedDialect {
+				t.Errorf("expected dialect to be = %+v, got = %+v", tt.expectedDialect, result.Dialect)
+			}
+			if result.Encoding != tt.expectedEncoding {
+				t.Errorf("expected encoding to be = %s, got = %s", tt.expectedEncoding, result.Encoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+const (
+	// EncodingUTF8 is UTF-8, with or without byte order mark.
+	EncodingUTF8 = "utf-8"
+
+	// EncodingUTF16LE is little endian UTF-16, as written by Windows tools.
+	EncodingUTF16LE = "utf-16le"
+
+	// EncodingUTF16BE is big endian UTF-16.
+	EncodingUTF16BE = "utf-16be"
+
+	// EncodingWindows1252 is the Western European code page of Windows, as written by Excel.
+	EncodingWindows1252 = "windows-1252"
+
+	// EncodingISO88591 is Latin-1.
+	EncodingISO88591 = "iso-8859-1"
+)
+
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+// encodings are the decoders of the encodings other than UTF-8.
+var encodings = map[string]encoding.Encoding{
+	EncodingUTF16LE:     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	EncodingUTF16BE:     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	EncodingWindows1252: charmap.Windows1252,
+	EncodingISO88591:    charmap.ISO8859_1,
+}
+
+// decodeText detects the encoding of the text read from r from a sample of sampleSize bytes. It returns
+// a reader of the text transcoded to UTF-8, without byte order mark, and the name of the original encoding.
+// Text detected as UTF-8 fails with ErrBadRequest on reading the first invalid sequence after the sample.
+func decodeText(r io.Reader, sampleSize int) (*bufio.Reader, string, error) {
+	br := bufio.NewReaderSize(r, sampleSize)
+	sample, err := br.Peek(sampleSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, "", err
+	}
+
+	name, bom := detectEncoding(sample, errors.Is(err, io.EOF))
+	if _, err := br.Discard(bom); err != nil {
+		return nil, "", err
+	}
+
+	decoder := transform.Transformer(&utf8Validator{offset: int64(bom)})
+	if name != EncodingUTF8 {
+		decoder = encodings[name].NewDecoder()
+	}
+	return bufio.NewReaderSize(transform.NewReader(br, decoder), sampleSize), name, nil
+}
+
+// utf8Validator passes valid UTF-8 through as it is and fails at the first invalid sequence.
+type utf8Validator struct {
+	transform.NopResetter
+
+	// offset is the offset of the next byte in the input.
+	offset int64
+}
+
+func (v *utf8Validator) Transform(dst, src []byte, atEOF bool) (int, int, error) {
+	var (
+		n   int
+		err error
+	)
+	for n < len(src) {
+		if src[n] < utf8.RuneSelf {
+			n++
+			continue
+		}
+		if !atEOF && !utf8.FullRune(src[n:]) {
+			err = transform.ErrShortSrc
+			break
+		}
+		r, size := utf8.DecodeRune(src[n:])
+		if r == utf8.RuneError && size == 1 {
+			err = fmt.Errorf("invalid UTF-8 at byte %d: %w", v.offset+int64(n), domain.ErrBadRequest)
+			break
+		}
+		n += size
+	}
+
+	copied := copy(dst, src[:n])
+	v.offset += int64(copied)
+	if copied < n {
+		return copied, copied, transform.ErrShortDst
+	}
+	return copied, copied, err
+}
+
+// detectEncoding returns the encoding of the text starting with sample and the size of its byte order mark.
+// Text without byte order mark is UTF-16 when most of every other byte is zero, and UTF-8 when it is valid UTF-8.
+// Otherwise it is Windows-1252 when it uses the characters Windows-1252 adds to ISO-8859-1, and ISO-8859-1 when not.
+func detectEncoding(sample []byte, complete bool) (string, int) {
+	switch {
+	case bytes.HasPrefix(sample, utf8BOM):
+		return EncodingUTF8, len(utf8BOM)
+	case bytes.HasPrefix(sample, utf16LEBOM):
+		return EncodingUTF16LE, len(utf16LEBOM)
+	case bytes.HasPrefix(sample, utf16BEBOM):
+		return EncodingUTF16BE, len(utf16BEBOM)
+	}
+
+	// Text is mostly ASCII, which has a zero high byte in UTF-16.
+	var even, odd int
+	for i, b := range sample {
+		if b == 0 && i%2 == 0 {
+			even++
+		} else if b == 0 {
+			odd++
+		}
+	}
+	switch half := len(sample) / 2; {
+	case half > 0 && even > half/2 && odd*10 < even:
+		return EncodingUTF16BE, 0
+	case half > 0 && odd > half/2 && even*10 < odd:
+		return EncodingUTF16LE, 0
+	}
+
+	if !complete {
+		// The last character may have been cut off by the sample size.
+		for i := 1; i < utf8.UTFMax && i <= len(sample); i++ {
+			if utf8.RuneStart(sample[len(sample)-i]) {
+				if !utf8.FullRune(sample[len(sample)-i:]) {
+					sample = sample[:len(sample)-i]
+				}
+				break
+			}
+		}
+	}
+	if utf8.Valid(sample) {
+		return EncodingUTF8, 0
+	}
+
+	for _, b := range sample {
+		if b >= 0x80 && b <= 0x9f {
+			return EncodingWindows1252, 0
+		}
+	}
+	return EncodingISO88591, 0
+}
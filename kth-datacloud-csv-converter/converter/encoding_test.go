@@ -0,0 +1,109 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name        string
+		sample      []byte
+		complete    bool
+		expected    string
+		expectedBOM int
+	}{
+		{name: "ascii", sample: []byte("a,b\n1,2\n"), complete: true, expected: EncodingUTF8},
+		{name: "utf-8", sample: []byte("namn,ort\nÅsa,Göteborg\n"), complete: true, expected: EncodingUTF8},
+		{name: "utf-8 with byte order mark", sample: []byte("\xef\xbb\xbfa,b\n"), complete: true, expected: EncodingUTF8, expectedBOM: 3},
+		{name: "utf-8 cut off by the sample", sample: []byte("namn\nÅsa\n\xc3"), expected: EncodingUTF8},
+		{name: "utf-16le with byte order mark", sample: []byte("\xff\xfea\x00,\x00b\x00"), complete: true, expected: EncodingUTF16LE, expectedBOM: 2},
+		{name: "utf-16be with byte order mark", sample: []byte("\xfe\xff\x00a\x00,\x00b"), complete: true, expected: EncodingUTF16BE, expectedBOM: 2},
+		{name: "utf-16le", sample: []byte("a\x00,\x00b\x00\n\x001\x00,\x002\x00\n\x00"), complete: true, expected: EncodingUTF16LE},
+		{name: "utf-16be", sample: []byte("\x00a\x00,\x00b\x00\n\x001\x00,\x002\x00\n"), complete: true, expected: EncodingUTF16BE},
+		{name: "latin-1", sample: []byte("namn;ort\n\xc5sa;G\xf6teborg\n"), complete: true, expected: EncodingISO88591},
+		{name: "windows-1252", sample: []byte("namn;pris\nkaffe;\x8025\n"), complete: true, expected: EncodingWindows1252},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, bom := detectEncoding(tt.sample, tt.complete)
+			if name != tt.expected {
+				t.Errorf("expected encoding to be = %s, got = %s", tt.expected, name)
+			}
+			if bom != tt.expectedBOM {
+				t.Errorf("expected byte order mark to be = %d bytes, got = %d bytes", tt.expectedBOM, bom)
+			}
+		})
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            []byte
+		sampleSize       int
+		expected         string
+		expectedEncoding string
+		expectedErr      error
+	}{
+		{
+			name:             "latin-1 is transcoded",
+			input:            []byte("namn;ort\n\xc5sa;G\xf6teborg\n"),
+			sampleSize:       64,
+			expected:         "namn;ort\nÅsa;Göteborg\n",
+			expectedEncoding: EncodingISO88591,
+		},
+		{
+			name:             "windows-1252 is transcoded",
+			input:            []byte("namn;pris\nkaffe;\x8025\n"),
+			sampleSize:       64,
+			expected:         "namn;pris\nkaffe;€25\n",
+			expectedEncoding: EncodingWindows1252,
+		},
+		{
+			name:             "byte order mark is dropped",
+			input:            []byte("\xef\xbb\xbfnamn\nÅsa\n"),
+			sampleSize:       64,
+			expected:         "namn\nÅsa\n",
+			expectedEncoding: EncodingUTF8,
+		},
+		{
+			name:             "utf-8 split across reads",
+			input:            bytes.Repeat([]byte("Åsa,Göteborg\n"), 100),
+			sampleSize:       16,
+			expected:         string(bytes.Repeat([]byte("Åsa,Göteborg\n"), 100)),
+			expectedEncoding: EncodingUTF8,
+		},
+		{
+			name:        "latin-1 after a utf-8 sample",
+			input:       append(bytes.Repeat([]byte("namn,ort\n"), 10), []byte("\xc5sa,G\xf6teborg\n")...),
+			sampleSize:  16,
+			expectedErr: domain.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br, encoding, err := decodeText(bytes.NewReader(tt.input), tt.sampleSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encoding != tt.expectedEncoding && tt.expectedErr == nil {
+				t.Errorf("expected encoding to be = %s, got = %s", tt.expectedEncoding, encoding)
+			}
+
+			b, err := io.ReadAll(br)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err == nil && string(b) != tt.expected {
+				t.Errorf("expected text to be = %q, got = %q", tt.expected, string(b))
+			}
+		})
+	}
+}
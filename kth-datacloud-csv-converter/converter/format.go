@@ -0,0 +1,69 @@
+package converter
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Format is a file format the converter reads or writes.
+type Format string
+
+const (
+	// FormatTSV is tab separated text.
+	FormatTSV = Format("tsv")
+
+	// FormatCSV is comma separated text.
+	FormatCSV = Format("csv")
+
+	// FormatPSV is pipe separated text.
+	FormatPSV = Format("psv")
+
+	// FormatSSV is semicolon separated text, as exported by Excel in locales using a decimal comma.
+	FormatSSV = Format("ssv")
+
+	// FormatDelimited is text separated by the delimiter given in the options.
+	FormatDelimited = Format("delimited")
+
+	// FormatXLSX is an Office Open XML workbook, as written by Excel.
+	FormatXLSX = Format("xlsx")
+
+	// FormatODS is an OpenDocument spreadsheet, as written by LibreOffice.
+	FormatODS = Format("ods")
+
+	// FormatParquet is Apache Parquet, a columnar format of typed columns.
+	FormatParquet = Format("parquet")
+
+	// FormatJSON is a JSON array of objects.
+	FormatJSON = Format("json")
+
+	// FormatNDJSON is JSON Lines, a JSON object on every line.
+	FormatNDJSON = Format("ndjson")
+)
+
+// delimiters are the delimiters of the delimited text formats.
+var delimiters = map[Format]rune{
+	FormatTSV: '\t',
+	FormatCSV: ',',
+	FormatPSV: '|',
+	FormatSSV: ';',
+}
+
+// extensions maps file extensions to the format they usually hold.
+var extensions = map[string]Format{
+	".tsv":     FormatTSV,
+	".tab":     FormatTSV,
+	".csv":     FormatCSV,
+	".psv":     FormatPSV,
+	".ssv":     FormatSSV,
+	".xlsx":    FormatXLSX,
+	".ods":     FormatODS,
+	".parquet": FormatParquet,
+	".json":    FormatJSON,
+	".ndjson":  FormatNDJSON,
+	".jsonl":   FormatNDJSON,
+}
+
+// FormatOf returns the format of the file at path by its extension, it is empty when the extension is unknown.
+func FormatOf(path string) Format {
+	return extensions[strings.ToLower(filepath.Ext(path))]
+}
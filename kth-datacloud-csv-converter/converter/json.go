@@ -0,0 +1,617 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+// jsonEncoder writes CSV as JSON objects with a typed value for every field, null when the row has no value
+// for it. The types are supplied in the options or inferred from all rows. Objects are written one per line,
+// as JSON Lines, or as the elements of an array.
+type jsonEncoder struct {
+	lines bool
+}
+
+func (e jsonEncoder) Encode(ctx context.Context, r io.ReadSeeker, w io.Writer, header bool, options Options) (Result, error) {
+	// Every value has to fit the type of its column, so no row can be left out.
+	options.SchemaSample = 0
+	schema, err := InferSchema(ctx, r, header, options)
+	if err != nil {
+		return Result{}, err
+	}
+	schema.Fields = uniqueFields(schema.Fields, func(name string) string { return name })
+	schema.nested = true
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Result{}, err
+	}
+
+	format, open, separator, end := FormatJSON, "[\n", ",\n", "\n]\n"
+	if e.lines {
+		format, open, separator, end = FormatNDJSON, "", "\n", "\n"
+	}
+
+	bw := bufio.NewWriter(w)
+	tree := newJSONTree(schema.Fields, schema.nested)
+	values := make([][]byte, len(schema.Fields))
+	result := Result{Format: format, Schema: &schema}
+	err = readCSV(ctx, r, header, func(record []string) error {
+		for i, f := range schema.Fields {
+			value := ""
+			if i < len(record) {
+				value = record[i]
+			}
+
+			v, err := jsonValue(f.Type, value)
+			if err != nil {
+				return fmt.Errorf("value %q of column %q in row %d is not %s: %w", value, f.Name, result.RowsWritten+1, f.Type, domain.ErrBadRequest)
+			}
+			if values[i], err = marshalJSON(v); err != nil {
+				return err
+			}
+		}
+
+		if result.RowsWritten == 0 {
+			bw.WriteString(open)
+		} else {
+			bw.WriteString(separator)
+		}
+		tree.write(bw, values)
+
+		result.RowsWritten++
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	switch {
+	case result.RowsWritten > 0:
+		bw.WriteString(end)
+	case !e.lines:
+		bw.WriteString("[]\n")
+	}
+	return result, bw.Flush()
+}
+
+// jsonValue returns value as a JSON value of the type, empty values are null. Timestamps are written
+// in RFC 3339 in UTC.
+func jsonValue(t ColumnType, value string) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	switch t {
+	case TypeInteger:
+		if leadingZero(value) {
+			return nil, errors.New("leading zero")
+		}
+		return strconv.ParseInt(value, 10, 64)
+	case TypeNumber:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		if math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, errors.New("not a finite number")
+		}
+		return n, nil
+	case TypeBoolean:
+		return parseBool(value)
+	case TypeDate:
+		d, err := parseDate(value)
+		if err != nil {
+			return nil, err
+		}
+		return d.Format("2006-01-02"), nil
+	case TypeDateTime:
+		t, err := parseDateTime(value)
+		if err != nil {
+			return nil, err
+		}
+		return t.UTC().Format(time.RFC3339Nano), nil
+	default:
+		return value, nil
+	}
+}
+
+// marshalJSON returns the JSON of v, leaving the characters of HTML as they are.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// jsonNode is a member of a JSON object, a value of a field or an object of nested members.
+type jsonNode struct {
+	// key is the JSON of the name of the member.
+	key []byte
+
+	// field is the index of the field of a value, -1 for objects.
+	field int
+
+	members []*jsonNode
+	objects map[string]*jsonNode
+}
+
+// newJSONTree returns the object of the fields. When nested, the parts of names separated by dots are the
+// names of nested objects, so address.city is the member city of the object address. A name is taken as
+// it is when a part is empty or when a field is named by the start of it, as an object cannot be a value.
+func newJSONTree(fields []Field, nested bool) *jsonNode {
+	names := map[string]bool{}
+	for _, f := range fields {
+		names[f.Name] = true
+	}
+
+	root := &jsonNode{field: -1}
+	for i, f := range fields {
+		parts := []string{f.Name}
+		if nested {
+			parts = nestedParts(f.Name, names)
+		}
+
+		node := root
+		for _, part := range parts[:len(parts)-1] {
+			node = node.object(part)
+		}
+		node.members = append(node.members, &jsonNode{key: jsonString(parts[len(parts)-1]), field: i})
+	}
+	return root
+}
+
+// nestedParts returns the parts of name naming nested objects and the member holding the value.
+func nestedParts(name string, names map[string]bool) []string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if part == "" || (i > 0 && names[strings.Join(parts[:i], ".")]) {
+			return []string{name}
+		}
+	}
+	return parts
+}
+
+// object returns the nested object of the name, which is added when there is none.
+func (n *jsonNode) object(name string) *jsonNode {
+	if o, ok := n.objects[name]; ok {
+		return o
+	}
+
+	o := &jsonNode{key: jsonString(name), field: -1}
+	if n.objects == nil {
+		n.objects = map[string]*jsonNode{}
+	}
+	n.objects[name] = o
+	n.members = append(n.members, o)
+	return o
+}
+
+// write writes the object with the JSON of the values of the fields.
+func (n *jsonNode) write(w *bufio.Writer, values [][]byte) {
+	w.WriteByte('{')
+	for i, m := range n.members {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.Write(m.key)
+		w.WriteByte(':')
+
+		if m.field < 0 {
+			m.write(w, values)
+			continue
+		}
+		w.Write(values[m.field])
+	}
+	w.WriteByte('}')
+}
+
+// jsonString returns the JSON of s.
+func jsonString(s string) []byte {
+	// Strings always marshal.
+	b, _ := marshalJSON(s)
+	return b
+}
+
+// How arrays of JSON input are flattened.
+const (
+	// ArraysJoin joins the elements of arrays into a cell, separated by the array separator.
+	// Elements that are objects or arrays are written as JSON.
+	ArraysJoin = "join"
+
+	// ArraysExplode writes a row for every element of arrays, repeating the other values of the record.
+	// Every array of a record multiplies its rows by its number of elements.
+	ArraysExplode = "explode"
+)
+
+// DefaultArraySeparator separates the elements of arrays joined into a cell.
+const DefaultArraySeparator = "|"
+
+// maxExplodedRows is the maximum number of rows a record of JSON input is exploded into.
+const maxExplodedRows = 1 << 16
+
+// jsonRootColumn is the column of values of JSON input that are not members of an object.
+const jsonRootColumn = "value"
+
+// jsonConverter converts JSON into CSV with a column for every value of the records, named by the names of
+// the nested objects holding it and its own name separated by dots, such as address.city. The records are
+// the elements of a document that is an array, the document itself otherwise, or the values of JSON Lines.
+// The columns are those of all records in the order they are first seen, so the input is read twice.
+type jsonConverter struct {
+	lines bool
+
+	// sampleSize is the number of bytes the encoding is detected from.
+	sampleSize int
+}
+
+func (c jsonConverter) Convert(ctx context.Context, r io.Reader, w io.Writer, options Options) (Result, error) {
+	f, err := newFlattener(options)
+	if err != nil {
+		return Result{}, err
+	}
+
+	ra, size, err := readerAt(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var (
+		columns []string
+		index   = map[string]int{}
+	)
+	_, err = c.read(ctx, io.NewSectionReader(ra, 0, size), options, func(v interface{}) error {
+		rows, err := f.rows("", v)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			for _, cell := range row {
+				if _, ok := index[cell.column]; !ok {
+					index[cell.column] = len(columns)
+					columns = append(columns, cell.column)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Format: FormatCSV}
+	writer := csv.NewWriter(w)
+	if len(columns) > 0 {
+		if err := writer.Write(columns); err != nil {
+			return Result{}, err
+		}
+		result.RowsWritten++
+	}
+
+	record := make([]string, len(columns))
+	result.Encoding, err = c.read(ctx, io.NewSectionReader(ra, 0, size), options, func(v interface{}) error {
+		rows, err := f.rows("", v)
+		if err != nil {
+			return err
+		}
+
+		result.RowsRead++
+		for _, row := range rows {
+			for i := range record {
+				record[i] = ""
+			}
+			// Members of the same name, written with dots or nested, are the same column and the last one is kept.
+			for _, cell := range row {
+				record[index[cell.column]] = cell.value
+			}
+
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+			result.RowsWritten++
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// read calls fn with each record of the JSON read from r and returns the original encoding of the input.
+// Objects are read as jsonObject to keep the order of their members, and numbers as json.Number.
+func (c jsonConverter) read(ctx context.Context, r io.Reader, options Options, fn func(v interface{}) error) (string, error) {
+	br, encoding, err := decodeText(r, c.sampleSize)
+	if err != nil {
+		return "", err
+	}
+
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+
+	records := 0
+	record := func(token json.Token) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		records++
+		v, err := readJSON(dec, token)
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s input at record %d: %v: %w", options.Input, records, err, domain.ErrBadRequest)
+		}
+		return fn(v)
+	}
+
+	token, err := dec.Token()
+	for ; err == nil; token, err = dec.Token() {
+		if !c.lines && token == json.Delim('[') {
+			// The elements of the document are the records.
+			for dec.More() {
+				token, err := dec.Token()
+				if err != nil {
+					return "", fmt.Errorf("failed to read %s input at record %d: %v: %w", options.Input, records+1, err, domain.ErrBadRequest)
+				}
+				if err := record(token); err != nil {
+					return "", err
+				}
+			}
+			if _, err := dec.Token(); err != nil {
+				if errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				return "", fmt.Errorf("failed to read %s input: %v: %w", options.Input, err, domain.ErrBadRequest)
+			}
+		} else if err := record(token); err != nil {
+			return "", err
+		}
+
+		if !c.lines {
+			// A document is a single value.
+			if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+				return "", fmt.Errorf("failed to read %s input: data after the document: %w", options.Input, domain.ErrBadRequest)
+			}
+			return encoding, nil
+		}
+	}
+	if !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read %s input at record %d: %v: %w", options.Input, records+1, err, domain.ErrBadRequest)
+	}
+	return encoding, nil
+}
+
+// readJSON reads the value starting with token from dec.
+func readJSON(dec *json.Decoder, token json.Token) (interface{}, error) {
+	switch token {
+	case json.Delim('{'):
+		o := jsonObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			token, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := readJSON(dec, token)
+			if err != nil {
+				return nil, err
+			}
+			o = append(o, jsonMember{name: key.(string), value: v})
+		}
+		_, err := dec.Token()
+		return o, err
+	case json.Delim('['):
+		a := []interface{}{}
+		for dec.More() {
+			token, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := readJSON(dec, token)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		_, err := dec.Token()
+		return a, err
+	default:
+		// Strings, numbers, booleans and null.
+		return token, nil
+	}
+}
+
+// jsonObject is a JSON object with its members in order.
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	name  string
+	value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value, err := marshalJSON(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(jsonString(m.name))
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// flattener flattens JSON values into rows of cells.
+type flattener struct {
+	explode   bool
+	separator string
+}
+
+// newFlattener returns the flattener of the options.
+func newFlattener(options Options) (flattener, error) {
+	f := flattener{separator: options.ArraySeparator}
+	switch options.Arrays {
+	case "", ArraysJoin:
+	case ArraysExplode:
+		f.explode = true
+	default:
+		return flattener{}, fmt.Errorf("invalid arrays %q, not %s or %s: %w", options.Arrays, ArraysJoin, ArraysExplode, domain.ErrBadRequest)
+	}
+	if f.separator == "" {
+		f.separator = DefaultArraySeparator
+	}
+	return f, nil
+}
+
+// jsonRow is a row of cells in the order of the values they were flattened from.
+type jsonRow []jsonCell
+
+type jsonCell struct {
+	column string
+	value  string
+}
+
+// rows returns the rows of v at the column, a single row unless arrays are exploded. An empty column
+// is the root of a record.
+func (f flattener) rows(column string, v interface{}) ([]jsonRow, error) {
+	switch v := v.(type) {
+	case jsonObject:
+		rows := []jsonRow{{}}
+		for _, m := range v {
+			name := m.name
+			if column != "" {
+				name = column + "." + m.name
+			}
+
+			member, err := f.rows(name, m.value)
+			if err != nil {
+				return nil, err
+			}
+			if rows, err = product(rows, member); err != nil {
+				return nil, err
+			}
+		}
+		return rows, nil
+	case []interface{}:
+		if !f.explode {
+			cell, err := f.join(v)
+			if err != nil {
+				return nil, err
+			}
+			return []jsonRow{{{column: rootColumn(column), value: cell}}}, nil
+		}
+
+		var rows []jsonRow
+		for _, e := range v {
+			element, err := f.rows(column, e)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, element...)
+			if len(rows) > maxExplodedRows {
+				return nil, fmt.Errorf("record explodes into more than %d rows: %w", maxExplodedRows, domain.ErrBadRequest)
+			}
+		}
+		if len(rows) == 0 {
+			// An empty array has no value.
+			return []jsonRow{{}}, nil
+		}
+		return rows, nil
+	default:
+		return []jsonRow{{{column: rootColumn(column), value: jsonScalar(v)}}}, nil
+	}
+}
+
+// join returns the elements of a joined into a cell.
+func (f flattener) join(a []interface{}) (string, error) {
+	elements := make([]string, len(a))
+	for i, e := range a {
+		switch e.(type) {
+		case jsonObject, []interface{}:
+			b, err := marshalJSON(e)
+			if err != nil {
+				return "", err
+			}
+			elements[i] = string(b)
+		default:
+			elements[i] = jsonScalar(e)
+		}
+	}
+	return strings.Join(elements, f.separator), nil
+}
+
+// product returns every row of a combined with every row of b.
+func product(a, b []jsonRow) ([]jsonRow, error) {
+	if len(b) == 1 {
+		// The rows of a are not shared, so they take the cells as they are.
+		for i := range a {
+			a[i] = append(a[i], b[0]...)
+		}
+		return a, nil
+	}
+	if len(a)*len(b) > maxExplodedRows {
+		return nil, fmt.Errorf("record explodes into more than %d rows: %w", maxExplodedRows, domain.ErrBadRequest)
+	}
+
+	rows := make([]jsonRow, 0, len(a)*len(b))
+	for _, x := range a {
+		for _, y := range b {
+			row := make(jsonRow, 0, len(x)+len(y))
+			rows = append(rows, append(append(row, x...), y...))
+		}
+	}
+	return rows, nil
+}
+
+// rootColumn returns the column, named jsonRootColumn at the root of a record.
+func rootColumn(column string) string {
+	if column == "" {
+		return jsonRootColumn
+	}
+	return column
+}
+
+// jsonScalar returns the text of a string, number or boolean, null is empty.
+func jsonScalar(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,254 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+func TestJSONEncode(t *testing.T) {
+	tests := []struct {
+		name        string
+		csv         string
+		header      bool
+		lines       bool
+		options     Options
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "typed values and nulls as an array",
+			csv:      "id,price,paid,day,at,name\n1,9.5,true,2024-01-31,2024-01-31T14:45:00+01:00,<Åsa & co>\n2,,,,,\n",
+			header:   true,
+			expected: "[\n{\"id\":1,\"price\":9.5,\"paid\":true,\"day\":\"2024-01-31\",\"at\":\"2024-01-31T13:45:00Z\",\"name\":\"<Åsa & co>\"},\n{\"id\":2,\"price\":null,\"paid\":null,\"day\":null,\"at\":null,\"name\":null}\n]\n",
+		},
+		{
+			name:     "json lines",
+			csv:      "id,name\n1,a\n2,b\n",
+			header:   true,
+			lines:    true,
+			expected: "{\"id\":1,\"name\":\"a\"}\n{\"id\":2,\"name\":\"b\"}\n",
+		},
+		{
+			name:     "dotted names are nested objects",
+			csv:      "id,address.city,address.geo.lat,address.zip\n1,Kista,59.4,16440\n",
+			header:   true,
+			lines:    true,
+			expected: "{\"id\":1,\"address\":{\"city\":\"Kista\",\"geo\":{\"lat\":59.4},\"zip\":16440}}\n",
+		},
+		{
+			name:     "names that cannot be nested are taken as they are",
+			csv:      "a,a.b,.c,d.\n1,2,3,4\n",
+			header:   true,
+			lines:    true,
+			expected: "{\"a\":1,\"a.b\":2,\".c\":3,\"d.\":4}\n",
+		},
+		{
+			name:     "duplicate and missing names",
+			csv:      "x,x,\n1,2,3\n",
+			header:   true,
+			lines:    true,
+			expected: "{\"x\":1,\"x_2\":2,\"column_3\":3}\n",
+		},
+		{
+			name:     "short rows are null",
+			csv:      "a,b\n1\n",
+			header:   true,
+			lines:    true,
+			expected: "{\"a\":1,\"b\":null}\n",
+		},
+		{
+			name:     "without header",
+			csv:      "1,x\n",
+			lines:    true,
+			expected: "{\"column_1\":1,\"column_2\":\"x\"}\n",
+		},
+		{
+			name:     "leading zeros are kept as text",
+			csv:      "zip\n01234\n",
+			header:   true,
+			lines:    true,
+			expected: "{\"zip\":\"01234\"}\n",
+		},
+		{
+			name:     "empty array",
+			csv:      "a,b\n",
+			header:   true,
+			expected: "[]\n",
+		},
+		{
+			name:     "empty json lines",
+			csv:      "a,b\n",
+			header:   true,
+			lines:    true,
+			expected: "",
+		},
+		{
+			name:        "value not of the type of the options",
+			csv:         "n\nx\n",
+			header:      true,
+			options:     Options{ColumnTypes: map[string]ColumnType{"n": TypeNumber}},
+			expectedErr: domain.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			result, err := jsonEncoder{lines: tt.lines}.Encode(context.Background(), strings.NewReader(tt.csv), &out, tt.header, tt.options)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if out.String() != tt.expected {
+				t.Errorf("expected output to be = %q, got = %q", tt.expected, out.String())
+			}
+
+			format := FormatJSON
+			if tt.lines {
+				format = FormatNDJSON
+			}
+			if result.Format != format {
+				t.Errorf("expected format to be = %s, got = %s", format, result.Format)
+			}
+		})
+	}
+}
+
+func TestJSONConvert(t *testing.T) {
+	// Two arrays of 300 elements explode into more rows than a record may have.
+	elements := strings.TrimSuffix(strings.Repeat("1,", 300), ",")
+	huge := `{"a":[` + elements + `],"b":[` + elements + `]}`
+
+	tests := []struct {
+		name             string
+		input            string
+		lines            bool
+		options          Options
+		expected         string
+		expectedRowsRead int
+		expectedErr      error
+	}{
+		{
+			name:             "nested objects are dotted columns in the order first seen",
+			input:            `[{"id":1,"address":{"city":"Kista","geo":{"lat":59.4}}},{"id":2,"name":"x","address":null}]`,
+			expected:         "id,address.city,address.geo.lat,name,address\n1,Kista,59.4,,\n2,,,x,\n",
+			expectedRowsRead: 2,
+		},
+		{
+			name:             "document that is an object",
+			input:            `{"id":1,"ok":true}`,
+			expected:         "id,ok\n1,true\n",
+			expectedRowsRead: 1,
+		},
+		{
+			name:             "arrays are joined",
+			input:            "{\"id\":1,\"tags\":[\"a\",\"b\"],\"items\":[{\"n\":1},[2]]}\n{\"id\":2,\"tags\":[]}\n",
+			lines:            true,
+			expected:         "id,tags,items\n1,a|b,\"{\"\"n\"\":1}|[2]\"\n2,,\n",
+			expectedRowsRead: 2,
+		},
+		{
+			name:             "arrays are joined by the separator",
+			input:            `{"tags":["a","b",null,3]}`,
+			lines:            true,
+			options:          Options{Arrays: ArraysJoin, ArraySeparator: ";"},
+			expected:         "tags\na;b;;3\n",
+			expectedRowsRead: 1,
+		},
+		{
+			name:             "arrays are exploded into rows",
+			input:            `{"id":1,"tags":["a","b"],"items":[{"n":1},{"n":2,"m":3}]}`,
+			lines:            true,
+			options:          Options{Arrays: ArraysExplode},
+			expected:         "id,tags,items.n,items.m\n1,a,1,\n1,a,2,3\n1,b,1,\n1,b,2,3\n",
+			expectedRowsRead: 1,
+		},
+		{
+			name:             "empty arrays are exploded into no value",
+			input:            `{"id":1,"tags":[]}`,
+			lines:            true,
+			options:          Options{Arrays: ArraysExplode},
+			expected:         "id\n1\n",
+			expectedRowsRead: 1,
+		},
+		{
+			name:             "values that are not objects",
+			input:            "1\n\"x\"\n[true,false]\n",
+			lines:            true,
+			expected:         "value\n1\nx\ntrue|false\n",
+			expectedRowsRead: 3,
+		},
+		{
+			name:             "dotted names and nested objects are the same column",
+			input:            `{"a.b":1,"a":{"b":2}}`,
+			lines:            true,
+			expected:         "a.b\n2\n",
+			expectedRowsRead: 1,
+		},
+		{
+			name:             "numbers are kept as written",
+			input:            `{"n":12345678901234567890,"f":1.10}`,
+			lines:            true,
+			expected:         "n,f\n12345678901234567890,1.10\n",
+			expectedRowsRead: 1,
+		},
+		{
+			name:             "latin-1 input",
+			input:            "{\"namn\":\"\xc5sa\"}",
+			lines:            true,
+			expected:         "namn\nÅsa\n",
+			expectedRowsRead: 1,
+		},
+		{
+			name:        "record exploding into too many rows",
+			input:       huge,
+			lines:       true,
+			options:     Options{Arrays: ArraysExplode},
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "invalid arrays",
+			input:       `{}`,
+			options:     Options{Arrays: "nest"},
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "truncated document",
+			input:       `[{"id":1},`,
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "data after the document",
+			input:       `{"id":1} {"id":2}`,
+			expectedErr: domain.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			tt.options.Input = FormatJSON
+			c := jsonConverter{lines: tt.lines, sampleSize: DefaultSampleSize}
+			result, err := c.Convert(context.Background(), strings.NewReader(tt.input), &out, tt.options)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if out.String() != tt.expected {
+				t.Errorf("expected output to be = %q, got = %q", tt.expected, out.String())
+			}
+			if result.RowsRead != tt.expectedRowsRead {
+				t.Errorf("expected rows read to be = %d, got = %d", tt.expectedRowsRead, result.RowsRead)
+			}
+		})
+	}
+}
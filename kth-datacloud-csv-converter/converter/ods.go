@@ -0,0 +1,353 @@
+package converter
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+const odsContent = "content.xml"
+
+// Namespaces of the OpenDocument elements and attributes that are read.
+const (
+	officeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	tableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+	textNS   = "urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+)
+
+// odsDuration is a time of day written as an ISO 8601 duration, such as PT13H45M00S.
+var odsDuration = regexp.MustCompile(`^PT(\d+)H(\d+)M(\d+)(?:[.,]\d+)?S$`)
+
+// odsSheet is a table of an OpenDocument spreadsheet.
+type odsSheet struct {
+	name string
+	rows [][]string
+}
+
+// odsBook is an OpenDocument spreadsheet, as written by LibreOffice.
+type odsBook struct {
+	sheetsOf []odsSheet
+}
+
+// openODS reads the tables of an OpenDocument spreadsheet. All tables are in the same part,
+// so they are read at once.
+func openODS(zr *zip.Reader) (workbook, error) {
+	f, err := zr.Open(odsContent)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", odsContent, errMissingPart)
+	}
+	defer f.Close()
+
+	book := &odsBook{}
+	d := xml.NewDecoder(f)
+	for {
+		token, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v: %w", odsContent, err, domain.ErrBadRequest)
+		}
+
+		if start, ok := token.(xml.StartElement); ok && start.Name.Space == tableNS && start.Name.Local == "table" {
+			sheet, err := readODSTable(d, start)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read table %q: %v: %w", sheet.name, err, domain.ErrBadRequest)
+			}
+			book.sheetsOf = append(book.sheetsOf, sheet)
+		}
+	}
+
+	return book, nil
+}
+
+func (b *odsBook) sheets() []string {
+	names := make([]string, len(b.sheetsOf))
+	for i, s := range b.sheetsOf {
+		names[i] = s.name
+	}
+	return names
+}
+
+func (b *odsBook) rows(index int) ([][]string, error) {
+	return b.sheetsOf[index].rows, nil
+}
+
+// readODSTable reads the rows of the table started by start. Rows and cells repeated to fill
+// the table up to its last styled row or column are never stored unless they hold values.
+func readODSTable(d *xml.Decoder, start xml.StartElement) (odsSheet, error) {
+	sheet := odsSheet{name: attr(start, tableNS, "name")}
+
+	var (
+		cells  sheetCells
+		merged []cellRange
+		row    int
+	)
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return sheet, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space != tableNS {
+				if err := d.Skip(); err != nil {
+					return sheet, err
+				}
+				continue
+			}
+
+			switch t.Name.Local {
+			case "table-row":
+				// Repeats beyond the limits of a sheet can only be empty.
+				repeat := attrInt(t, tableNS, "number-rows-repeated", 1)
+				if repeat > maxSheetRows {
+					repeat = maxSheetRows
+				}
+				values, err := readODSRow(d)
+				if err != nil {
+					return sheet, err
+				}
+
+				for i := 0; i < repeat && len(values) > 0; i++ {
+					for _, c := range values {
+						if err := cells.set(row+i, c.col, c.value); err != nil {
+							return sheet, err
+						}
+						if c.rows > 1 || c.cols > 1 {
+							merged = append(merged, cellRange{
+								firstRow: row + i, firstCol: c.col,
+								lastRow: row + i + c.rows - 1, lastCol: c.col + c.cols - 1,
+							})
+						}
+					}
+				}
+				row += repeat
+			case "table-header-rows", "table-rows", "table-row-group":
+				// Groups of rows hold rows, read on.
+			default:
+				if err := d.Skip(); err != nil {
+					return sheet, err
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Space == tableNS && t.Name.Local == "table" {
+				err := cells.fillMerged(merged)
+				sheet.rows = cells.rows
+				return sheet, err
+			}
+		}
+	}
+}
+
+// odsCell is a cell holding a value, it spans rows and columns when it is merged.
+type odsCell struct {
+	col        int
+	value      string
+	rows, cols int
+}
+
+// readODSRow reads the cells of a row holding values, up to the end of the row.
+func readODSRow(d *xml.Decoder) ([]odsCell, error) {
+	var (
+		cells []odsCell
+		col   int
+	)
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			// Repeats beyond the limits of a sheet can only be empty.
+			repeat := attrInt(t, tableNS, "number-columns-repeated", 1)
+			if repeat > maxSheetCols {
+				repeat = maxSheetCols
+			}
+			if t.Name.Space != tableNS || t.Name.Local != "table-cell" {
+				// Covered cells are hidden by a merged cell, they take up columns all the same.
+				if t.Name.Space == tableNS && t.Name.Local == "covered-table-cell" {
+					col += repeat
+				}
+				if err := d.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			value, err := readODSCell(d, t)
+			if err != nil {
+				return nil, err
+			}
+			if value != "" {
+				if col+repeat > maxSheetCols {
+					return nil, errSheetTooLarge
+				}
+
+				// Merged ranges are clipped to the cells holding values, spans only need to stay within the sheet.
+				rows := attrInt(t, tableNS, "number-rows-spanned", 1)
+				if rows > maxSheetRows {
+					rows = maxSheetRows
+				}
+				cols := attrInt(t, tableNS, "number-columns-spanned", 1)
+				if cols > maxSheetCols {
+					cols = maxSheetCols
+				}
+				for i := 0; i < repeat; i++ {
+					cells = append(cells, odsCell{col: col + i, value: value, rows: rows, cols: cols})
+				}
+			}
+			col += repeat
+		case xml.EndElement:
+			return cells, nil
+		}
+	}
+}
+
+// readODSCell returns the value of the cell started by start, up to the end of the cell. Typed values,
+// the cached results of formulas among them, are taken from the attributes and text from the paragraphs.
+func readODSCell(d *xml.Decoder, start xml.StartElement) (string, error) {
+	var value string
+	switch attr(start, officeNS, "value-type") {
+	case "float", "percentage", "currency":
+		v := attr(start, officeNS, "value")
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid number %q", v)
+		}
+		value = strconv.FormatFloat(n, 'f', -1, 64)
+	case "date":
+		// Dates are written in ISO 8601 already.
+		value = attr(start, officeNS, "date-value")
+	case "time":
+		v := attr(start, officeNS, "time-value")
+		m := odsDuration.FindStringSubmatch(v)
+		if m == nil {
+			return "", fmt.Errorf("invalid time %q", v)
+		}
+		hours, _ := strconv.Atoi(m[1])
+		minutes, _ := strconv.Atoi(m[2])
+		seconds, _ := strconv.Atoi(m[3])
+		value = fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds)
+	case "boolean":
+		value = attr(start, officeNS, "boolean-value")
+	default:
+		return readODSText(d)
+	}
+
+	return value, d.Skip()
+}
+
+// readODSText returns the paragraphs of a text cell separated by line feeds, up to the end of the cell.
+// Comments on the cell are not part of its text.
+func readODSText(d *xml.Decoder) (string, error) {
+	var (
+		b          strings.Builder
+		paragraphs int
+	)
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space != textNS || (t.Name.Local != "p" && t.Name.Local != "h") {
+				if err := d.Skip(); err != nil {
+					return "", err
+				}
+				continue
+			}
+
+			if paragraphs > 0 {
+				b.WriteByte('\n')
+			}
+			paragraphs++
+			if err := readODSParagraph(d, &b); err != nil {
+				return "", err
+			}
+		case xml.EndElement:
+			return b.String(), nil
+		}
+	}
+}
+
+// readODSParagraph writes the text of a paragraph to b, up to the end of the paragraph.
+func readODSParagraph(d *xml.Decoder, b *strings.Builder) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			b.Write(t)
+		case xml.StartElement:
+			if t.Name.Space != textNS {
+				// Comments and frames.
+				if err := d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+
+			switch t.Name.Local {
+			case "s":
+				// Runs of spaces are written as a count.
+				n := attrInt(t, textNS, "c", 1)
+				if n > maxCellText-b.Len() {
+					return errCellTooLarge
+				}
+				b.WriteString(strings.Repeat(" ", n))
+			case "tab":
+				b.WriteByte('\t')
+			case "line-break":
+				b.WriteByte('\n')
+			case "note":
+				// Footnotes are not part of the text.
+			default:
+				// Spans and links hold text.
+				if err := readODSParagraph(d, b); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// attr returns the attribute of start in the namespace, empty when it has none.
+func attr(start xml.StartElement, space, local string) string {
+	for _, a := range start.Attr {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// attrInt returns the positive number of the attribute of start in the namespace, fallback when it has none.
+func attrInt(start xml.StartElement, space, local string, fallback int) int {
+	n, err := strconv.Atoi(attr(start, space, local))
+	if err != nil || n < 1 {
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,97 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+// odsArchive returns a spreadsheet with a single table holding rows, the content of the table.
+func odsArchive(t *testing.T, rows string) []byte {
+	return xlsxArchive(t, map[string]string{
+		"mimetype": "application/vnd.oasis.opendocument.spreadsheet",
+		odsContent: `<office:document-content xmlns:office="` + officeNS + `" xmlns:table="` + tableNS + `" xmlns:text="` + textNS + `">` +
+			`<office:body><office:spreadsheet><table:table table:name="Sheet1">` + rows + `</table:table></office:spreadsheet></office:body></office:document-content>`,
+	})
+}
+
+func TestODSConvert(t *testing.T) {
+	tests := []struct {
+		name        string
+		archive     []byte
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "typed values and cached results of formulas",
+			archive:  odsArchive(t, `<table:table-row><table:table-cell office:value-type="float" office:value="1234.50"/><table:table-cell office:value-type="percentage" office:value="0.25"/><table:table-cell office:value-type="date" office:date-value="2023-03-15"/><table:table-cell office:value-type="time" office:time-value="PT18H05M30S"/><table:table-cell office:value-type="boolean" office:boolean-value="true"/><table:table-cell table:formula="of:=[.A1]*2" office:value-type="float" office:value="2469"><text:p>2 469</text:p></table:table-cell></table:table-row>`),
+			expected: "1234.5,0.25,2023-03-15,18:05:30,true,2469\n",
+		},
+		{
+			name:     "text of paragraphs, spaces and spans without comments",
+			archive:  odsArchive(t, `<table:table-row><table:table-cell office:value-type="string"><office:annotation><text:p>comment</text:p></office:annotation><text:p>a<text:s text:c="2"/>b<text:span>c</text:span></text:p><text:p>d<text:tab/>e</text:p></table:table-cell></table:table-row>`),
+			expected: "\"a  bc\nd\te\"\n",
+		},
+		{
+			name:     "merged cells hold the value of the range",
+			archive:  odsArchive(t, `<table:table-row><table:table-cell table:number-columns-spanned="2" table:number-rows-spanned="2" office:value-type="string"><text:p>group</text:p></table:table-cell><table:covered-table-cell/><table:table-cell office:value-type="string"><text:p>c</text:p></table:table-cell></table:table-row><table:table-row><table:covered-table-cell table:number-columns-repeated="2"/><table:table-cell office:value-type="string"><text:p>d</text:p></table:table-cell></table:table-row>`),
+			expected: "group,group,c\ngroup,group,d\n",
+		},
+		{
+			name:     "repeated values",
+			archive:  odsArchive(t, `<table:table-row table:number-rows-repeated="2"><table:table-cell table:number-columns-repeated="2" office:value-type="float" office:value="0"/></table:table-row>`),
+			expected: "0,0\n0,0\n",
+		},
+		{
+			name:        "run of spaces longer than a cell",
+			archive:     odsArchive(t, `<table:table-row><table:table-cell office:value-type="string"><text:p>a<text:s text:c="2000000000"/></text:p></table:table-cell></table:table-row>`),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "runs of spaces adding up to more than a cell",
+			archive:     odsArchive(t, `<table:table-row><table:table-cell office:value-type="string"><text:p><text:s text:c="30000"/></text:p><text:p><text:s text:c="30000"/></text:p></table:table-cell></table:table-row>`),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "invalid time",
+			archive:     odsArchive(t, `<table:table-row><table:table-cell office:value-type="time" office:time-value="18:05"/></table:table-row>`),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:     "rows and columns repeated to fill the sheet are not stored",
+			archive:  odsArchive(t, `<table:table-row><table:table-cell office:value-type="string"><text:p>a</text:p></table:table-cell><table:table-cell table:number-columns-repeated="1000000000"/></table:table-row><table:table-row table:number-rows-repeated="2000000000"><table:table-cell table:number-columns-repeated="16384"/></table:table-row>`),
+			expected: "a\n",
+		},
+		{
+			name:     "merged range spanning the sheet is clipped to the values",
+			archive:  odsArchive(t, `<table:table-row><table:table-cell table:number-rows-spanned="100000000" table:number-columns-spanned="100000000" office:value-type="float" office:value="1"/><table:table-cell office:value-type="string"><text:p>b</text:p></table:table-cell></table:table-row><table:table-row><table:covered-table-cell/><table:table-cell office:value-type="string"><text:p>c</text:p></table:table-cell></table:table-row>`),
+			expected: "1,1\n1,1\n",
+		},
+		{
+			name:        "value beyond the last column",
+			archive:     odsArchive(t, `<table:table-row><table:table-cell table:number-columns-repeated="16384"/><table:table-cell office:value-type="string"><text:p>a</text:p></table:table-cell></table:table-row>`),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "repeated values beyond the last row",
+			archive:     odsArchive(t, `<table:table-row><table:table-cell/></table:table-row><table:table-row table:number-rows-repeated="2000000000"><table:table-cell office:value-type="string"><text:p>a</text:p></table:table-cell></table:table-row>`),
+			expectedErr: domain.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			_, err := workbookConverter{open: openODS}.Convert(context.Background(), bytes.NewReader(tt.archive), &out, Options{Input: FormatODS})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err == nil && out.String() != tt.expected {
+				t.Errorf("expected output to be = %q, got = %q", tt.expected, out.String())
+			}
+		})
+	}
+}
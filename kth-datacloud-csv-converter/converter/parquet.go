@@ -0,0 +1,416 @@
+package converter
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/marshal"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/types"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// DefaultRowGroupSize is the size of the row groups of written Parquet files, before compression.
+const DefaultRowGroupSize = 128 << 20 // 128 MiB.
+
+// DefaultCompression is the compression of the columns of written Parquet files.
+const DefaultCompression = "snappy"
+
+// parquetBatch is the number of rows read from each column of a Parquet file at once.
+const parquetBatch = 1024
+
+// Compressions are the compressions of the columns of written Parquet files, by name.
+var Compressions = map[string]parquet.CompressionCodec{
+	"none":   parquet.CompressionCodec_UNCOMPRESSED,
+	"snappy": parquet.CompressionCodec_SNAPPY,
+	"zstd":   parquet.CompressionCodec_ZSTD,
+	"gzip":   parquet.CompressionCodec_GZIP,
+}
+
+// epochDate is day zero of Parquet dates.
+var epochDate = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// secondsPerDay is the number of seconds in a day of Parquet dates, which have no leap seconds.
+const secondsPerDay = 24 * 60 * 60
+
+// parquetConverter converts Parquet files with flat schemas into CSV, with the column names as header.
+type parquetConverter struct{}
+
+func (parquetConverter) Convert(ctx context.Context, r io.Reader, w io.Writer, options Options) (Result, error) {
+	ra, size, err := readerAt(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	pr, err := reader.NewParquetColumnReader(newParquetFile(ra, size), int64(runtime.GOMAXPROCS(0)))
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open parquet input: %v: %w", err, domain.ErrBadRequest)
+	}
+	defer pr.ReadStop()
+
+	columns := pr.SchemaHandler.SchemaElements[1:]
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		if c.GetNumChildren() > 0 || c.GetRepetitionType() == parquet.FieldRepetitionType_REPEATED {
+			return Result{}, fmt.Errorf("parquet column %q is nested: %w", pr.SchemaHandler.GetExName(i+1), domain.ErrBadRequest)
+		}
+		// The reader renames the columns to Go identifiers, the names in the file are kept aside.
+		header[i] = pr.SchemaHandler.GetExName(i + 1)
+	}
+
+	result := Result{Format: FormatCSV}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return Result{}, err
+	}
+	result.RowsWritten++
+
+	rows := pr.GetNumRows()
+	values := make([][]interface{}, len(columns))
+	for read := int64(0); read < rows; read += parquetBatch {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+
+		n := rows - read
+		if n > parquetBatch {
+			n = parquetBatch
+		}
+		for i := range columns {
+			if values[i], _, _, err = pr.ReadColumnByIndex(int64(i), n); err != nil {
+				return Result{}, fmt.Errorf("failed to read parquet column %q: %v: %w", header[i], err, domain.ErrBadRequest)
+			}
+			if int64(len(values[i])) != n {
+				return Result{}, fmt.Errorf("parquet column %q is missing rows: %w", header[i], domain.ErrBadRequest)
+			}
+		}
+
+		record := make([]string, len(columns))
+		for row := 0; row < int(n); row++ {
+			for i, c := range columns {
+				record[i] = formatParquet(c, values[i][row])
+			}
+			if err := writer.Write(record); err != nil {
+				return Result{}, err
+			}
+		}
+		result.RowsRead += int(n)
+		result.RowsWritten += int(n)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// formatParquet writes a value of the column as text. Dates, times and timestamps are written in ISO 8601,
+// decimals with their scale and binary that is not text in base64.
+func formatParquet(column *parquet.SchemaElement, value interface{}) string {
+	logical := logicalType(column)
+	converted := parquet.ConvertedType(-1)
+	if column.IsSetConvertedType() {
+		converted = column.GetConvertedType()
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		return strconv.FormatBool(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int32:
+		switch {
+		case converted == parquet.ConvertedType_DATE || logical.IsSetDATE():
+			return epochDate.AddDate(0, 0, int(v)).Format("2006-01-02")
+		case converted == parquet.ConvertedType_TIME_MILLIS || logical.IsSetTIME():
+			return time.UnixMilli(int64(v)).UTC().Format("15:04:05.999")
+		case converted == parquet.ConvertedType_DECIMAL || logical.IsSetDECIMAL():
+			return types.DECIMAL_INT_ToString(int64(v), int(column.GetPrecision()), int(column.GetScale()))
+		case converted == parquet.ConvertedType_UINT_8 || converted == parquet.ConvertedType_UINT_16 ||
+			converted == parquet.ConvertedType_UINT_32:
+			return strconv.FormatUint(uint64(uint32(v)), 10)
+		}
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		switch unit := timeUnit(column); {
+		case converted == parquet.ConvertedType_TIMESTAMP_MILLIS || converted == parquet.ConvertedType_TIMESTAMP_MICROS ||
+			logical.IsSetTIMESTAMP():
+			return unixTime(v, unit).Format(time.RFC3339Nano)
+		case converted == parquet.ConvertedType_TIME_MICROS || logical.IsSetTIME():
+			return unixTime(v, unit).Format("15:04:05.999999999")
+		case converted == parquet.ConvertedType_DECIMAL || logical.IsSetDECIMAL():
+			return types.DECIMAL_INT_ToString(v, int(column.GetPrecision()), int(column.GetScale()))
+		case converted == parquet.ConvertedType_UINT_64:
+			return strconv.FormatUint(uint64(v), 10)
+		}
+		return strconv.FormatInt(v, 10)
+	case string:
+		switch {
+		case column.GetType() == parquet.Type_INT96:
+			// Timestamps as written by Impala and old Spark.
+			return types.INT96ToTime(v).UTC().Format(time.RFC3339Nano)
+		case converted == parquet.ConvertedType_DECIMAL || logical.IsSetDECIMAL():
+			return types.DECIMAL_BYTE_ARRAY_ToString([]byte(v), int(column.GetPrecision()), int(column.GetScale()))
+		case !utf8.ValidString(v):
+			return base64.StdEncoding.EncodeToString([]byte(v))
+		}
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// timeUnit returns the unit of the int64 times and timestamps of the column.
+func timeUnit(column *parquet.SchemaElement) time.Duration {
+	unit := parquet.NewTimeUnit()
+	switch logical := logicalType(column); {
+	case logical.IsSetTIMESTAMP() && logical.GetTIMESTAMP().IsSetUnit():
+		unit = logical.GetTIMESTAMP().GetUnit()
+	case logical.IsSetTIME() && logical.GetTIME().IsSetUnit():
+		unit = logical.GetTIME().GetUnit()
+	case column.GetConvertedType() == parquet.ConvertedType_TIMESTAMP_MILLIS:
+		return time.Millisecond
+	}
+
+	switch {
+	case unit.IsSetMILLIS():
+		return time.Millisecond
+	case unit.IsSetNANOS():
+		return time.Nanosecond
+	default:
+		return time.Microsecond
+	}
+}
+
+// unixTime returns the time v units after the Unix epoch in UTC. Durations only span
+// 292 years, so the time is not built by adding one to the epoch.
+func unixTime(v int64, unit time.Duration) time.Time {
+	switch unit {
+	case time.Millisecond:
+		return time.UnixMilli(v).UTC()
+	case time.Microsecond:
+		return time.UnixMicro(v).UTC()
+	default:
+		return time.Unix(v/int64(time.Second), v%int64(time.Second)).UTC()
+	}
+}
+
+// logicalType returns the logical type of the column, which is empty for files written before logical types.
+func logicalType(column *parquet.SchemaElement) *parquet.LogicalType {
+	if column.IsSetLogicalType() {
+		return column.GetLogicalType()
+	}
+	return parquet.NewLogicalType()
+}
+
+// parquetEncoder writes CSV as Parquet with a typed column for every field, which is nullable when
+// any row has no value for it. The types are supplied in the options or inferred from all rows.
+type parquetEncoder struct {
+	rowGroupSize int64
+	compression  parquet.CompressionCodec
+}
+
+func (e parquetEncoder) Encode(ctx context.Context, r io.ReadSeeker, w io.Writer, header bool, options Options) (Result, error) {
+	// Every value has to fit the type of its column, so no row can be left out.
+	options.SchemaSample = 0
+	schema, err := InferSchema(ctx, r, header, options)
+	if err != nil {
+		return Result{}, err
+	}
+	// Parquet tells columns apart by their names as Go identifiers.
+	schema.Fields = uniqueFields(schema.Fields, common.StringToVariableName)
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Result{}, err
+	}
+
+	pw, err := writer.NewParquetWriterFromWriter(w, parquetSchema(schema.Fields), int64(runtime.GOMAXPROCS(0)))
+	if err != nil {
+		return Result{}, err
+	}
+	// Rows are slices of values in the order of the columns.
+	pw.MarshalFunc = marshal.MarshalCSV
+	pw.RowGroupSize = e.rowGroupSize
+	pw.CompressionType = e.compression
+
+	result := Result{Format: FormatParquet, Schema: &schema}
+	err = readCSV(ctx, r, header, func(record []string) error {
+		row := make([]interface{}, len(schema.Fields))
+		for i, value := range record {
+			f := schema.Fields[i]
+			v, err := parquetValue(f.Type, value)
+			if err != nil {
+				return fmt.Errorf("value %q of column %q in row %d is not %s: %w", value, f.Name, result.RowsWritten+1, f.Type, domain.ErrBadRequest)
+			}
+			row[i] = v
+		}
+
+		result.RowsWritten++
+		return pw.Write(row)
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err := pw.WriteStop(); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// parquetSchema returns the Parquet schema of the fields. Timestamps are in microseconds in UTC.
+func parquetSchema(fields []Field) []*parquet.SchemaElement {
+	root := parquet.NewSchemaElement()
+	root.Name = "schema"
+	root.NumChildren = int32Ptr(int32(len(fields)))
+	root.RepetitionType = parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_REQUIRED)
+
+	schema := []*parquet.SchemaElement{root}
+	for _, f := range fields {
+		e := parquet.NewSchemaElement()
+		e.Name = f.Name
+		e.RepetitionType = parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_OPTIONAL)
+		if f.required() {
+			e.RepetitionType = parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_REQUIRED)
+		}
+
+		switch f.Type {
+		case TypeInteger:
+			e.Type = parquet.TypePtr(parquet.Type_INT64)
+		case TypeNumber:
+			e.Type = parquet.TypePtr(parquet.Type_DOUBLE)
+		case TypeBoolean:
+			e.Type = parquet.TypePtr(parquet.Type_BOOLEAN)
+		case TypeDate:
+			e.Type = parquet.TypePtr(parquet.Type_INT32)
+			e.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_DATE)
+			e.LogicalType = &parquet.LogicalType{DATE: parquet.NewDateType()}
+		case TypeDateTime:
+			e.Type = parquet.TypePtr(parquet.Type_INT64)
+			e.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_TIMESTAMP_MICROS)
+			e.LogicalType = &parquet.LogicalType{TIMESTAMP: &parquet.TimestampType{
+				IsAdjustedToUTC: true,
+				Unit:            &parquet.TimeUnit{MICROS: parquet.NewMicroSeconds()},
+			}}
+		default:
+			e.Type = parquet.TypePtr(parquet.Type_BYTE_ARRAY)
+			e.ConvertedType = parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)
+			e.LogicalType = &parquet.LogicalType{STRING: parquet.NewStringType()}
+		}
+		schema = append(schema, e)
+	}
+	return schema
+}
+
+// parquetValue returns value as a Parquet value of the type, empty values are null.
+func parquetValue(t ColumnType, value string) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	switch t {
+	case TypeInteger:
+		if leadingZero(value) {
+			return nil, errors.New("leading zero")
+		}
+		return strconv.ParseInt(value, 10, 64)
+	case TypeNumber:
+		return strconv.ParseFloat(value, 64)
+	case TypeBoolean:
+		return parseBool(value)
+	case TypeDate:
+		d, err := parseDate(value)
+		if err != nil {
+			return nil, err
+		}
+		// Dates are at midnight UTC, so the division has no remainder.
+		return int32(d.Unix() / secondsPerDay), nil
+	case TypeDateTime:
+		t, err := parseDateTime(value)
+		if err != nil {
+			return nil, err
+		}
+		return t.Unix()*int64(time.Second/time.Microsecond) + int64(t.Nanosecond())/int64(time.Microsecond), nil
+	default:
+		return value, nil
+	}
+}
+
+// readCSV calls fn with every record of the CSV read from r, leaving out the first record
+// when it is a header. The records are reused between calls.
+func readCSV(ctx context.Context, r io.Reader, header bool, fn func(record []string) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	for first := true; ; first = false {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if first && header {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+// parquetFile is a Parquet file read from r. Every file opened on it reads on its own.
+type parquetFile struct {
+	*io.SectionReader
+	r    io.ReaderAt
+	size int64
+}
+
+var _ source.ParquetFile = (*parquetFile)(nil)
+
+func newParquetFile(r io.ReaderAt, size int64) *parquetFile {
+	return &parquetFile{SectionReader: io.NewSectionReader(r, 0, size), r: r, size: size}
+}
+
+func (f *parquetFile) Open(string) (source.ParquetFile, error) {
+	return newParquetFile(f.r, f.size), nil
+}
+
+func (f *parquetFile) Create(string) (source.ParquetFile, error) {
+	return nil, errors.New("parquet input is read only")
+}
+
+func (f *parquetFile) Write([]byte) (int, error) {
+	return 0, errors.New("parquet input is read only")
+}
+
+func (f *parquetFile) Close() error {
+	return nil
+}
@@ -0,0 +1,143 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+	"github.com/xitongsys/parquet-go/parquet"
+)
+
+func TestParquetRoundTrip(t *testing.T) {
+	tests := []struct {
+		name           string
+		csv            string
+		options        Options
+		compression    parquet.CompressionCodec
+		expected       string
+		expectedFields []Field
+		expectedErr    error
+	}{
+		{
+			name:        "typed columns with nulls",
+			csv:         "id,price,paid,day,at,name\n1,9.5,true,2023-03-15,2023-03-15T12:30:00Z,Åsa\n2,,,,,\n3,10,false,2023-03-16,2023-03-16T00:00:00+01:00,\"a, b\"\n",
+			compression: parquet.CompressionCodec_SNAPPY,
+			expected:    "id,price,paid,day,at,name\n1,9.5,true,2023-03-15,2023-03-15T12:30:00Z,Åsa\n2,,,,,\n3,10,false,2023-03-16,2023-03-15T23:00:00Z,\"a, b\"\n",
+			expectedFields: []Field{
+				{Name: "id", Type: TypeInteger},
+				{Name: "price", Type: TypeNumber},
+				{Name: "paid", Type: TypeBoolean},
+				{Name: "day", Type: TypeDate},
+				{Name: "at", Type: TypeDateTime},
+				{Name: "name", Type: TypeString},
+			},
+		},
+		{
+			name:           "column types of the options",
+			csv:            "zip,count\n01234,7\n,8\n",
+			options:        Options{ColumnTypes: map[string]ColumnType{"count": TypeString}},
+			compression:    parquet.CompressionCodec_ZSTD,
+			expected:       "zip,count\n01234,7\n,8\n",
+			expectedFields: []Field{{Name: "zip", Type: TypeString}, {Name: "count", Type: TypeString}},
+		},
+		{
+			name:        "dates and timestamps further than 292 years from 1970",
+			csv:         "day,at\n9999-12-31,9999-12-31T23:59:59.999999Z\n1600-01-01,1600-01-01T00:00:00Z\n",
+			compression: parquet.CompressionCodec_SNAPPY,
+			expected:    "day,at\n9999-12-31,9999-12-31T23:59:59.999999Z\n1600-01-01,1600-01-01T00:00:00Z\n",
+			expectedFields: []Field{
+				{Name: "day", Type: TypeDate},
+				{Name: "at", Type: TypeDateTime},
+			},
+		},
+		{
+			name:        "value not of the type of the options",
+			csv:         "count\nmany\n",
+			options:     Options{ColumnTypes: map[string]ColumnType{"count": TypeInteger}},
+			compression: parquet.CompressionCodec_UNCOMPRESSED,
+			expectedErr: domain.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var encoded bytes.Buffer
+			e := parquetEncoder{rowGroupSize: DefaultRowGroupSize, compression: tt.compression}
+			result, err := e.Encode(context.Background(), strings.NewReader(tt.csv), &encoded, true, tt.options)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			var fields []Field
+			for _, f := range result.Schema.Fields {
+				fields = append(fields, Field{Name: f.Name, Type: f.Type})
+			}
+			if !reflect.DeepEqual(fields, tt.expectedFields) {
+				t.Errorf("expected fields to be = %+v, got = %+v", tt.expectedFields, fields)
+			}
+
+			var out bytes.Buffer
+			decoded, err := parquetConverter{}.Convert(context.Background(), &encoded, &out, Options{Input: FormatParquet})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("expected output to be = %q, got = %q", tt.expected, out.String())
+			}
+			if decoded.RowsRead != result.RowsWritten {
+				t.Errorf("expected rows read to be = %d, got = %d", result.RowsWritten, decoded.RowsRead)
+			}
+		})
+	}
+}
+
+func TestParquetConvertInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "not parquet", input: "a,b\n1,2\n"},
+		{name: "empty", input: ""},
+		{name: "magic bytes only", input: "PAR1PAR1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			_, err := parquetConverter{}.Convert(context.Background(), strings.NewReader(tt.input), &out, Options{Input: FormatParquet})
+			if !errors.Is(err, domain.ErrBadRequest) {
+				t.Errorf("expected error to be = %v, got = %v", domain.ErrBadRequest, err)
+			}
+		})
+	}
+}
+
+func TestUnixTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    int64
+		unit     time.Duration
+		expected string
+	}{
+		{name: "milliseconds", value: 253402300799999, unit: time.Millisecond, expected: "9999-12-31T23:59:59.999Z"},
+		{name: "microseconds", value: -11676096000000000, unit: time.Microsecond, expected: "1600-01-01T00:00:00Z"},
+		{name: "nanoseconds", value: 1678883400000000001, unit: time.Nanosecond, expected: "2023-03-15T12:30:00.000000001Z"},
+		{name: "nanoseconds before 1970", value: -1, unit: time.Nanosecond, expected: "1969-12-31T23:59:59.999999999Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unixTime(tt.value, tt.unit).Format(time.RFC3339Nano); got != tt.expected {
+				t.Errorf("expected time to be = %s, got = %s", tt.expected, got)
+			}
+		})
+	}
+}
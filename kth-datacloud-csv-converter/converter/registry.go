@@ -0,0 +1,464 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+// Converter converts the content read from r into its output format and writes it to w.
+type Converter interface {
+	Convert(ctx context.Context, r io.Reader, w io.Writer, options Options) (Result, error)
+}
+
+// Result describes a converted file.
+type Result struct {
+	// Format is the format of the converted file.
+	Format Format
+
+	// Path is the path of the converted file.
+	Path string
+
+	// Sheet is the name of the sheet of workbook input the file was converted from.
+	Sheet string
+
+	// Dialect is the dialect detected in delimited text input, nil for other input.
+	Dialect *Dialect
+
+	// Encoding is the original encoding of text input, which was transcoded to UTF-8.
+	Encoding string
+
+	// RowsRead and RowsWritten count the records of text input and the rows of sheets,
+	// blank lines and empty rows are read but not written.
+	RowsRead    int
+	RowsWritten int
+
+	// RaggedRows is the number of records with another number of fields than the first record,
+	// the first of them are listed in Ragged.
+	RaggedRows int
+	Ragged     []Ragged
+
+	// Schema is the typed view of the columns of the converted file, nil when it has no columns.
+	Schema *Schema
+
+	// SchemaPath is the path of the schema written next to the converted file.
+	SchemaPath string
+}
+
+// Ragged is a record with another number of fields than the first record.
+type Ragged struct {
+	// Line is the line the record starts on.
+	Line     int `json:"line"`
+	Fields   int `json:"fields"`
+	Expected int `json:"expected"`
+}
+
+// Options are the settings of a single conversion.
+type Options struct {
+	// Input is the format of the input file, it is taken from the file extension when empty.
+	Input Format
+
+	// Output is the format to convert to.
+	Output Format
+
+	// Delimiter separates the fields of delimited text, it is detected when empty.
+	Delimiter string
+
+	// Sheet selects the sheet of workbook input by name, or by index counting from zero.
+	// The first sheet is converted when it is empty.
+	Sheet string
+
+	// AllSheets converts every sheet of workbook input into a file of its own.
+	AllSheets bool
+
+	// ColumnTypes are the types of columns by name, the types of other columns are inferred.
+	ColumnTypes map[string]ColumnType
+
+	// SchemaSample is the number of rows the schema of CSV output is inferred from, all rows when it is zero.
+	SchemaSample int
+
+	// Arrays is how arrays of JSON input are flattened, ArraysJoin or ArraysExplode. They are joined
+	// when it is empty.
+	Arrays string
+
+	// ArraySeparator separates the elements of arrays joined into a cell, DefaultArraySeparator when empty.
+	ArraySeparator string
+
+	// tempDir is the directory intermediate files are written to, the temporary directory of the system
+	// when empty. Files are converted with their intermediate files next to the output, on the same volume.
+	tempDir string
+}
+
+// delimiter returns the delimiter of the options, zero when none is set.
+func (o Options) delimiter() (rune, error) {
+	if o.Delimiter == "" {
+		return 0, nil
+	}
+
+	d, size := utf8.DecodeRuneInString(o.Delimiter)
+	if d == utf8.RuneError || size != len(o.Delimiter) || d == '"' || d == '\r' || d == '\n' {
+		return 0, fmt.Errorf("invalid delimiter %q: %w", o.Delimiter, domain.ErrBadRequest)
+	}
+	return d, nil
+}
+
+// key identifies the converter between two formats.
+type key struct {
+	input  Format
+	output Format
+}
+
+// Registry holds the converters by the formats they convert between.
+type Registry struct {
+	converters map[key]Converter
+
+	// sampleSize is the number of bytes from the start of delimited text its dialect is detected from.
+	sampleSize int
+
+	// rowGroupSize and compression are the size of the row groups and the compression of written Parquet files.
+	rowGroupSize int64
+	compression  string
+
+	// schemaFormat is the format of the schemas written next to converted files, one of SchemaFormats.
+	schemaFormat string
+}
+
+// WithSampleSize sets the number of bytes from the start of delimited text its dialect is detected from.
+func WithSampleSize(size int) func(*Registry) {
+	return func(r *Registry) {
+		r.sampleSize = size
+	}
+}
+
+// WithRowGroupSize sets the size in bytes of the row groups of written Parquet files, before compression.
+func WithRowGroupSize(size int64) func(*Registry) {
+	return func(r *Registry) {
+		r.rowGroupSize = size
+	}
+}
+
+// WithCompression sets the compression of the columns of written Parquet files, one of Compressions.
+func WithCompression(name string) func(*Registry) {
+	return func(r *Registry) {
+		r.compression = name
+	}
+}
+
+// WithSchemaFormat sets the format of the schemas written next to converted files, one of SchemaFormats.
+func WithSchemaFormat(name string) func(*Registry) {
+	return func(r *Registry) {
+		r.schemaFormat = name
+	}
+}
+
+// NewRegistry returns a registry holding the built-in converters, more can be registered before it is used.
+func NewRegistry(options ...func(*Registry)) *Registry {
+	r := &Registry{
+		converters:   map[key]Converter{},
+		sampleSize:   DefaultSampleSize,
+		rowGroupSize: DefaultRowGroupSize,
+		compression:  DefaultCompression,
+		schemaFormat: DefaultSchemaFormat,
+	}
+
+	// Set options.
+	for _, o := range options {
+		o(r)
+	}
+
+	r.Register(FormatTSV, FormatCSV, tsvConverter{sampleSize: r.sampleSize})
+	for _, input := range []Format{FormatCSV, FormatPSV, FormatSSV, FormatDelimited} {
+		r.Register(input, FormatCSV, delimitedConverter{delimiter: delimiters[input], sampleSize: r.sampleSize})
+	}
+	r.Register(FormatXLSX, FormatCSV, workbookConverter{open: openXLSX})
+	r.Register(FormatODS, FormatCSV, workbookConverter{open: openODS})
+	r.Register(FormatParquet, FormatCSV, parquetConverter{})
+	r.Register(FormatJSON, FormatCSV, jsonConverter{sampleSize: r.sampleSize})
+	r.Register(FormatNDJSON, FormatCSV, jsonConverter{lines: true, sampleSize: r.sampleSize})
+
+	// Every input converted into CSV is encoded into the other outputs from CSV.
+	encoders := map[Format]encoder{
+		FormatParquet: parquetEncoder{rowGroupSize: r.rowGroupSize, compression: Compressions[r.compression]},
+		FormatJSON:    jsonEncoder{},
+		FormatNDJSON:  jsonEncoder{lines: true},
+	}
+	csvConverters := map[Format]Converter{}
+	for k, c := range r.converters {
+		if k.output == FormatCSV {
+			csvConverters[k.input] = c
+		}
+	}
+	for input, c := range csvConverters {
+		for output, e := range encoders {
+			if output != input {
+				r.Register(input, output, chained{csv: c, encoder: e})
+			}
+		}
+	}
+
+	return r
+}
+
+// Register adds the converter from input to output, replacing the one registered before.
+// Registering is not safe while converters are looked up.
+func (r *Registry) Register(input, output Format, c Converter) {
+	r.converters[key{input: input, output: output}] = c
+}
+
+// Lookup returns the converter from input to output.
+func (r *Registry) Lookup(input, output Format) (Converter, error) {
+	c, ok := r.converters[key{input: input, output: output}]
+	if !ok {
+		return nil, fmt.Errorf("no converter from %q to %q: %w", input, output, domain.ErrBadRequest)
+	}
+	return c, nil
+}
+
+// ConvertFile converts the file at source into destination with the converter between the formats of the options.
+// When all sheets of a workbook are converted, each sheet is written next to destination with the name of the
+// sheet appended, and there is a result for every sheet. The schema of each converted file is written next to it.
+// Files are written under a temporary name and renamed once complete, so no partial file is ever seen at their
+// paths, and none are left behind when the conversion fails.
+func (r *Registry) ConvertFile(ctx context.Context, source, destination string, options Options) ([]Result, error) {
+	if options.Input == "" {
+		options.Input = FormatOf(source)
+	}
+
+	c, err := r.Lookup(options.Input, options.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return nil, err
+	}
+	options.tempDir = filepath.Dir(destination)
+
+	var results []Result
+	if options.AllSheets {
+		results, err = convertSheets(ctx, c, in, destination, options)
+	} else {
+		results, err = convert(ctx, c, in, destination, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		if err := r.writeSchema(ctx, &results[i], options); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// convert converts in into destination.
+func convert(ctx context.Context, c Converter, in io.Reader, destination string, options Options) ([]Result, error) {
+	out, err := createTemp(destination)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	result, err := c.Convert(ctx, in, out, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+	result.Path = destination
+
+	return []Result{result}, os.Rename(out.Name(), destination)
+}
+
+// convertSheets converts every sheet read from in into a file of its own next to destination.
+func convertSheets(ctx context.Context, c Converter, in io.Reader, destination string, options Options) ([]Result, error) {
+	sc, ok := c.(SheetConverter)
+	if !ok {
+		return nil, fmt.Errorf("%q input has no sheets: %w", options.Input, domain.ErrBadRequest)
+	}
+
+	var (
+		files []*os.File
+		paths []string
+		seen  = map[string]bool{}
+	)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	results, err := sc.ConvertSheets(ctx, in, func(sheet string) (io.Writer, error) {
+		path := sheetPath(destination, sheet)
+		if seen[path] {
+			// Sheet names differing in characters that are replaced end up at the same path.
+			path = sheetPath(destination, fmt.Sprintf("%s-%d", sheet, len(files)))
+		}
+		seen[path] = true
+
+		f, err := createTemp(path)
+		if err != nil {
+			return nil, err
+		}
+		files, paths = append(files, f), append(paths, path)
+		return f, nil
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+	}
+	// The sheets are renamed once all of them are complete.
+	for i, f := range files {
+		if err := os.Rename(f.Name(), paths[i]); err != nil {
+			return nil, err
+		}
+		results[i].Path = paths[i]
+	}
+	return results, nil
+}
+
+// writeSchema writes the schema of the converted file next to it, with the extension .schema.json.
+// The schema of CSV is inferred from the file.
+func (r *Registry) writeSchema(ctx context.Context, result *Result, options Options) error {
+	encode := SchemaFormats[r.schemaFormat]
+	if encode == nil {
+		return nil
+	}
+
+	if result.Schema == nil && result.Format == FormatCSV {
+		f, err := os.Open(result.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		// Sheets and Parquet have no dialect, their first row names the columns.
+		header := result.Dialect == nil || result.Dialect.Header
+		schema, err := InferSchema(ctx, f, header, options)
+		if err != nil {
+			return err
+		}
+		result.Schema = &schema
+	}
+	if result.Schema == nil {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(encode(*result.Schema), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := strings.TrimSuffix(result.Path, filepath.Ext(result.Path)) + ".schema.json"
+	if err := writeFile(path, b); err != nil {
+		return err
+	}
+	result.SchemaPath = path
+	return nil
+}
+
+// sheetPath returns destination with the name of the sheet appended to its base name.
+func sheetPath(destination, sheet string) string {
+	ext := filepath.Ext(destination)
+	return strings.TrimSuffix(destination, ext) + "-" + safeName(sheet) + ext
+}
+
+// OutputPath returns the path of the file converted into the output format for an event, in a directory
+// of its own under root named by the run and the event. Conversions running at the same time, in one
+// process or in several sharing root, never write to the same path.
+func OutputPath(root, runID, eventID string, output Format) (string, error) {
+	if runID == "" || eventID == "" {
+		return "", fmt.Errorf("no run or event ID for the output path: %w", domain.ErrBadRequest)
+	}
+	return filepath.Join(root, safeName(runID), safeName(eventID), "file."+string(output)), nil
+}
+
+// safeName returns name for use in a path. Characters other than letters, digits, dashes, underscores
+// and dots are replaced by underscores, and so are names of dots only, which point up or at the directory.
+func safeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+
+	if strings.Trim(name, ".") == "" {
+		return strings.Repeat("_", len(name))
+	}
+	return name
+}
+
+// createTemp creates a hidden temporary file next to path, to be renamed to path once it is complete.
+// It is readable by all, as converted files are read by other steps on the shared volume.
+func createTemp(path string) (*os.File, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// writeFile writes b to path under a temporary name and renames it once it is complete.
+func writeFile(path string, b []byte) error {
+	f, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// readerAt returns r for random access and its size. Input other than files has to be read entirely.
+func readerAt(r io.Reader) (io.ReaderAt, int64, error) {
+	if f, ok := r.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, 0, err
+		}
+		return f, info.Size(), nil
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(b), int64(len(b)), nil
+}
@@ -0,0 +1,235 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+// markConverter copies the input with a mark appended, standing in for a registered converter.
+type markConverter struct{}
+
+func (markConverter) Convert(ctx context.Context, r io.Reader, w io.Writer, options Options) (Result, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	_, err = w.Write([]byte(string(b) + "!"))
+	return Result{Format: options.Output}, err
+}
+
+func TestRegistryLookup(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       Format
+		output      Format
+		expectedErr error
+	}{
+		{name: "tsv to csv", input: FormatTSV, output: FormatCSV},
+		{name: "semicolon separated to csv", input: FormatSSV, output: FormatCSV},
+		{name: "delimited to csv", input: FormatDelimited, output: FormatCSV},
+		{name: "xlsx to csv", input: FormatXLSX, output: FormatCSV},
+		{name: "tsv to parquet through csv", input: FormatTSV, output: FormatParquet},
+		{name: "json to ndjson through csv", input: FormatJSON, output: FormatNDJSON},
+		{name: "csv to tsv", input: FormatCSV, output: FormatTSV, expectedErr: domain.ErrBadRequest},
+		{name: "parquet to parquet", input: FormatParquet, output: FormatParquet, expectedErr: domain.ErrBadRequest},
+		{name: "unknown input", input: Format("docx"), output: FormatCSV, expectedErr: domain.ErrBadRequest},
+	}
+
+	r := NewRegistry()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := r.Lookup(tt.input, tt.output)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err == nil && c == nil {
+				t.Errorf("expected a converter from %s to %s, got none", tt.input, tt.output)
+			}
+		})
+	}
+}
+
+func TestConvertFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		content     string
+		options     Options
+		register    bool
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "input format from the extension",
+			file:     "data.tsv",
+			content:  "a\tb\n1\t2\n",
+			options:  Options{Output: FormatCSV},
+			expected: "a,b\n1,2\n",
+		},
+		{
+			name:     "input format of the options",
+			file:     "data.txt",
+			content:  "a|b\n1|2\n",
+			options:  Options{Input: FormatPSV, Output: FormatCSV},
+			expected: "a,b\n1,2\n",
+		},
+		{
+			name:        "unknown extension",
+			file:        "data.txt",
+			content:     "a,b\n",
+			options:     Options{Output: FormatCSV},
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:     "registered converter replaces the built-in one",
+			file:     "data.tsv",
+			content:  "a\tb\n",
+			options:  Options{Output: FormatCSV},
+			register: true,
+			expected: "a\tb\n!",
+		},
+		{
+			name:        "invalid delimiter of the options",
+			file:        "data.txt",
+			content:     "a;b\n",
+			options:     Options{Input: FormatDelimited, Output: FormatCSV, Delimiter: ";;"},
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "failed conversion leaves no file",
+			file:        "data.xlsx",
+			content:     "not a workbook",
+			options:     Options{Output: FormatCSV},
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "truncated JSON leaves no file",
+			file:        "data.json",
+			content:     `{"a": `,
+			options:     Options{Output: FormatCSV},
+			expectedErr: domain.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(source, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			r := NewRegistry(WithSchemaFormat(SchemaNone))
+			if tt.register {
+				r.Register(FormatTSV, FormatCSV, markConverter{})
+			}
+
+			destination := filepath.Join(dir, "out", "file.csv")
+			results, err := r.ConvertFile(context.Background(), source, destination, tt.options)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				entries, _ := os.ReadDir(filepath.Join(dir, "out"))
+				if len(entries) != 0 {
+					t.Errorf("expected no files to be left, got = %d", len(entries))
+				}
+				return
+			}
+
+			if len(results) != 1 || results[0].Path != destination {
+				t.Fatalf("expected a result at %s, got = %+v", destination, results)
+			}
+
+			b, err := os.ReadFile(destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.expected {
+				t.Errorf("expected output to be = %q, got = %q", tt.expected, string(b))
+			}
+		})
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		runID       string
+		eventID     string
+		output      Format
+		expected    string
+		expectedErr error
+	}{
+		{name: "path of the run and event", runID: "pod-1", eventID: "42", output: FormatCSV, expected: "/data/pod-1/42/file.csv"},
+		{name: "separators are replaced", runID: "pod/1", eventID: "../../etc", output: FormatParquet, expected: "/data/pod_1/.._.._etc/file.parquet"},
+		{name: "dots only are replaced", runID: "..", eventID: ".", output: FormatJSON, expected: "/data/__/_/file.json"},
+		{name: "no event ID", runID: "pod-1", output: FormatCSV, expectedErr: domain.ErrBadRequest},
+		{name: "no run ID", eventID: "42", output: FormatCSV, expectedErr: domain.ErrBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := OutputPath("/data", tt.runID, tt.eventID, tt.output)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if path != tt.expected {
+				t.Errorf("expected path to be = %s, got = %s", tt.expected, path)
+			}
+		})
+	}
+}
+
+func TestConvertFileSheets(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "book.xlsx")
+	archive := xlsxArchive(t, map[string]string{
+		xlsxWorkbook:               `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="a/b" sheetId="1" r:id="rId1"/><sheet name="a:b" sheetId="2" r:id="rId1"/></sheets></workbook>`,
+		xlsxRelationships:          xlsxRelationshipsXML,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData><row r="1"><c r="A1"><v>1</v></c></row></sheetData></worksheet>`,
+	})
+	if err := os.WriteFile(source, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	destination := filepath.Join(dir, "out", "file.csv")
+	results, err := NewRegistry(WithSchemaFormat(SchemaNone)).ConvertFile(context.Background(), source, destination, Options{Output: FormatCSV, AllSheets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sheet names replaced to the same name get a number appended.
+	expected := []string{filepath.Join(dir, "out", "file-a_b.csv"), filepath.Join(dir, "out", "file-a_b-1.csv")}
+	var paths []string
+	for _, result := range results {
+		paths = append(paths, result.Path)
+	}
+	if len(paths) != len(expected) || paths[0] != expected[0] || paths[1] != expected[1] {
+		t.Fatalf("expected paths to be = %v, got = %v", expected, paths)
+	}
+
+	// No temporary files are left next to the converted files.
+	entries, err := os.ReadDir(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(expected) {
+		t.Errorf("expected %d files, got = %d", len(expected), len(entries))
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0644 {
+			t.Errorf("expected mode of %s to be = 0644, got = %o", path, info.Mode().Perm())
+		}
+	}
+}
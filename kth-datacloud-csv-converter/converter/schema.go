@@ -0,0 +1,313 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	// SchemaTable writes schemas as Frictionless Table Schema.
+	SchemaTable = "table-schema"
+
+	// SchemaJSON writes schemas as JSON Schema of the rows as objects.
+	SchemaJSON = "json-schema"
+
+	// SchemaNone writes no schemas.
+	SchemaNone = "none"
+)
+
+// DefaultSchemaFormat is the format schemas are written in.
+const DefaultSchemaFormat = SchemaTable
+
+// maxEnumValues is the maximum number of distinct values of a column with enum candidates.
+const maxEnumValues = 20
+
+// jsonSchemaDraft is the version of JSON Schema that schemas are written in.
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// SchemaFormats are the formats schemas are written in by name, none writes no schema.
+var SchemaFormats = map[string]func(Schema) interface{}{
+	SchemaTable: func(s Schema) interface{} { return s },
+	SchemaJSON:  func(s Schema) interface{} { return s.jsonSchema() },
+	SchemaNone:  nil,
+}
+
+// Schema is the typed view of the columns of a converted file, as a Frictionless Table Schema.
+// Empty values are missing.
+type Schema struct {
+	Fields        []Field  `json:"fields"`
+	MissingValues []string `json:"missingValues"`
+
+	// nested reports whether the rows are written as objects nesting the fields with dotted names.
+	nested bool
+}
+
+// Field is a column of a schema.
+type Field struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type"`
+
+	// Format is how the values are written, empty for the default format of the type.
+	Format string `json:"format,omitempty"`
+
+	Constraints *Constraints `json:"constraints,omitempty"`
+}
+
+// Constraints are the constraints on the values of a field.
+type Constraints struct {
+	// Required reports whether every row has a value, otherwise the field is nullable.
+	Required bool `json:"required,omitempty"`
+
+	// Enum are the values of a text field with few distinct values that repeat, candidates for an enum.
+	Enum []string `json:"enum,omitempty"`
+}
+
+// required reports whether every row has a value for the field.
+func (f Field) required() bool {
+	return f.Constraints != nil && f.Constraints.Required
+}
+
+// InferSchema reads the CSV read from r and infers the type, nullability and enum candidates of each column,
+// from the first options.SchemaSample rows or from every row when it is zero. Header tells whether the first
+// record names the columns, columns without name are named by their position. Types supplied in the options
+// are taken as is.
+func InferSchema(ctx context.Context, r io.Reader, header bool, options Options) (Schema, error) {
+	var (
+		names     []string
+		inference schemaInference
+		first     = header
+	)
+	err := readCSV(ctx, r, false, func(record []string) error {
+		if first {
+			names, first = append(names, record...), false
+			return nil
+		}
+		if options.SchemaSample > 0 && inference.rows >= options.SchemaSample {
+			return errSampled
+		}
+
+		inference.add(record)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errSampled) {
+		return Schema{}, err
+	}
+
+	return inference.schema(names, options)
+}
+
+// errSampled stops reading when the sample is complete.
+var errSampled = errors.New("sample is complete")
+
+// schemaInference infers the columns of rows. A column starts out with the most specific type of its first
+// value and widens as values do not fit, integers to numbers, dates to timestamps and anything else to strings.
+type schemaInference struct {
+	columns []columnInference
+	rows    int
+}
+
+type columnInference struct {
+	// t is the type of the column, empty while it has no values.
+	t ColumnType
+
+	// nulls reports whether any row has no value for the column.
+	nulls bool
+
+	// count is the number of values.
+	count int
+
+	// distinct counts each distinct value, it is nil once there are too many for an enum.
+	distinct map[string]int
+}
+
+// add widens the columns to the values of record.
+func (s *schemaInference) add(record []string) {
+	for len(s.columns) < len(record) {
+		// Rows before this one had no value for a new column.
+		s.columns = append(s.columns, columnInference{nulls: s.rows > 0, distinct: map[string]int{}})
+	}
+	s.rows++
+
+	for i := range s.columns {
+		c := &s.columns[i]
+		if i >= len(record) || record[i] == "" {
+			c.nulls = true
+			continue
+		}
+
+		value := record[i]
+		c.t = widen(c.t, value)
+		c.count++
+		if c.distinct != nil {
+			c.distinct[value]++
+			if len(c.distinct) > maxEnumValues {
+				c.distinct = nil
+			}
+		}
+	}
+}
+
+// schema returns the schema of the columns with the given names.
+func (s *schemaInference) schema(names []string, options Options) (Schema, error) {
+	width := len(names)
+	if len(s.columns) > width {
+		width = len(s.columns)
+	}
+
+	schema := Schema{Fields: make([]Field, width), MissingValues: []string{""}}
+	for i := range schema.Fields {
+		c := columnInference{t: TypeString, nulls: true}
+		if i < len(s.columns) {
+			c = s.columns[i]
+		}
+
+		name := fmt.Sprintf("column_%d", i+1)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		inferred := c.t
+		if inferred == "" {
+			inferred = TypeString
+		}
+		t, err := columnType(name, inferred, options)
+		if err != nil {
+			return Schema{}, err
+		}
+
+		field := Field{Name: name, Type: t}
+		if t == TypeDateTime {
+			// Timestamps are not always written in the default format of the Table Schema.
+			field.Format = "any"
+		}
+
+		constraints := Constraints{Required: !c.nulls}
+		// Values that mostly repeat are codes rather than free text.
+		if t == TypeString && c.distinct != nil && len(c.distinct) > 0 && c.count >= 2*len(c.distinct) {
+			for value := range c.distinct {
+				constraints.Enum = append(constraints.Enum, value)
+			}
+			sort.Strings(constraints.Enum)
+		}
+		if constraints.Required || len(constraints.Enum) > 0 {
+			field.Constraints = &constraints
+		}
+
+		schema.Fields[i] = field
+	}
+
+	return schema, nil
+}
+
+// uniqueFields returns the fields with names made unique by a number appended, where names with the same key
+// are the same.
+func uniqueFields(fields []Field, key func(name string) string) []Field {
+	seen := map[string]bool{}
+	unique := make([]Field, len(fields))
+	for i, f := range fields {
+		name := f.Name
+		for n := 2; seen[key(name)]; n++ {
+			name = fmt.Sprintf("%s_%d", f.Name, n)
+		}
+		seen[key(name)] = true
+
+		unique[i] = f
+		unique[i].Name = name
+	}
+	return unique
+}
+
+// jsonSchema returns the schema as JSON Schema of the rows as objects, where nullable fields may be null.
+// Every member is required, it is null when it has no value.
+func (s Schema) jsonSchema() interface{} {
+	return jsonSchemaObject{
+		draft:  jsonSchemaDraft,
+		node:   newJSONTree(s.Fields, s.nested),
+		fields: s.Fields,
+	}
+}
+
+// jsonSchemaObject is the JSON Schema of an object of the fields, with the properties in the order of
+// its members. Draft is only set on the schema of the rows.
+type jsonSchemaObject struct {
+	draft  string
+	node   *jsonNode
+	fields []Field
+}
+
+func (o jsonSchemaObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	if o.draft != "" {
+		b.WriteString(`"$schema":`)
+		b.Write(jsonString(o.draft))
+		b.WriteByte(',')
+	}
+	b.WriteString(`"type":"object","properties":{`)
+
+	required := make([]json.RawMessage, len(o.node.members))
+	for i, m := range o.node.members {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		required[i] = m.key
+
+		var property interface{} = jsonSchemaObject{node: m, fields: o.fields}
+		if m.field >= 0 {
+			property = jsonSchemaProperty(o.fields[m.field])
+		}
+		value, err := json.Marshal(property)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(m.key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+
+	names, err := json.Marshal(required)
+	if err != nil {
+		return nil, err
+	}
+	b.WriteString(`},"required":`)
+	b.Write(names)
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// jsonSchemaProperty returns the JSON Schema of the values of the field.
+func jsonSchemaProperty(f Field) interface{} {
+	property := struct {
+		Type   interface{}   `json:"type"`
+		Format string        `json:"format,omitempty"`
+		Enum   []interface{} `json:"enum,omitempty"`
+	}{}
+
+	t := "string"
+	switch f.Type {
+	case TypeInteger, TypeNumber, TypeBoolean:
+		t = string(f.Type)
+	case TypeDate:
+		property.Format = "date"
+	case TypeDateTime:
+		property.Format = "date-time"
+	}
+	property.Type = t
+	if !f.required() {
+		property.Type = []string{t, "null"}
+	}
+	if f.Constraints != nil {
+		for _, value := range f.Constraints.Enum {
+			property.Enum = append(property.Enum, value)
+		}
+	}
+	if len(property.Enum) > 0 && !f.required() {
+		property.Enum = append(property.Enum, nil)
+	}
+	return property
+}
@@ -0,0 +1,188 @@
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+func TestWiden(t *testing.T) {
+	tests := []struct {
+		name     string
+		t        ColumnType
+		value    string
+		expected ColumnType
+	}{
+		{name: "first value integer", value: "42", expected: TypeInteger},
+		{name: "first value number", value: "-4.2e3", expected: TypeNumber},
+		{name: "first value boolean", value: "TRUE", expected: TypeBoolean},
+		{name: "first value date", value: "2024-01-31", expected: TypeDate},
+		{name: "first value timestamp", value: "2024-01-31 13:45", expected: TypeDateTime},
+		{name: "leading zero is text", value: "007", expected: TypeString},
+		{name: "decimal comma is text", value: "1,5", expected: TypeString},
+		{name: "integer widens to number", t: TypeInteger, value: "1.5", expected: TypeNumber},
+		{name: "date widens to timestamp", t: TypeDate, value: "2024-01-31T13:45:00Z", expected: TypeDateTime},
+		{name: "timestamp takes dates", t: TypeDateTime, value: "2024-01-31", expected: TypeDateTime},
+		{name: "number does not narrow", t: TypeNumber, value: "2", expected: TypeNumber},
+		{name: "boolean widens to string", t: TypeBoolean, value: "yes", expected: TypeString},
+		{name: "empty value fits", t: TypeInteger, value: "", expected: TypeInteger},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := widen(tt.t, tt.value); got != tt.expected {
+				t.Errorf("expected type to be = %s, got = %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestInferSchema(t *testing.T) {
+	tests := []struct {
+		name        string
+		csv         string
+		header      bool
+		options     Options
+		expected    []Field
+		expectedErr error
+	}{
+		{
+			name:   "types, nullability and enums",
+			csv:    "id,price,status,seen\n1,10,open,2024-01-31\n2,,closed,2024-02-01T08:00:00Z\n3,2.5,open,\n4,3,open,2024-02-02\n",
+			header: true,
+			expected: []Field{
+				{Name: "id", Type: TypeInteger, Constraints: &Constraints{Required: true}},
+				{Name: "price", Type: TypeNumber},
+				{Name: "status", Type: TypeString, Constraints: &Constraints{Required: true, Enum: []string{"closed", "open"}}},
+				{Name: "seen", Type: TypeDateTime, Format: "any"},
+			},
+		},
+		{
+			name:    "first rows only",
+			csv:     "n\n1\n2\nthree\n",
+			header:  true,
+			options: Options{SchemaSample: 2},
+			expected: []Field{
+				{Name: "n", Type: TypeInteger, Constraints: &Constraints{Required: true}},
+			},
+		},
+		{
+			name:   "columns without names",
+			csv:    "true,x\nfalse,y\n",
+			header: false,
+			expected: []Field{
+				{Name: "column_1", Type: TypeBoolean, Constraints: &Constraints{Required: true}},
+				{Name: "column_2", Type: TypeString, Constraints: &Constraints{Required: true}},
+			},
+		},
+		{
+			name:   "columns of ragged rows",
+			csv:    "a\n1\n2,x\n",
+			header: true,
+			expected: []Field{
+				{Name: "a", Type: TypeInteger, Constraints: &Constraints{Required: true}},
+				{Name: "column_2", Type: TypeString},
+			},
+		},
+		{
+			name:    "types of the options",
+			csv:     "zip\n12345\n",
+			header:  true,
+			options: Options{ColumnTypes: map[string]ColumnType{"zip": TypeString}},
+			expected: []Field{
+				{Name: "zip", Type: TypeString, Constraints: &Constraints{Required: true}},
+			},
+		},
+		{
+			name:        "invalid type of the options",
+			csv:         "zip\n12345\n",
+			header:      true,
+			options:     Options{ColumnTypes: map[string]ColumnType{"zip": "postcode"}},
+			expectedErr: domain.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := InferSchema(context.Background(), strings.NewReader(tt.csv), tt.header, tt.options)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err == nil && !reflect.DeepEqual(schema.Fields, tt.expected) {
+				t.Errorf("expected fields to be = %+v, got = %+v", tt.expected, schema.Fields)
+			}
+		})
+	}
+}
+
+func TestWriteSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{
+			name:     "table schema",
+			format:   SchemaTable,
+			expected: `{"fields":[{"name":"id","type":"integer","constraints":{"required":true}},{"name":"at","type":"datetime","format":"any"}],"missingValues":[""]}`,
+		},
+		{
+			name:     "json schema",
+			format:   SchemaJSON,
+			expected: `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"object","properties":{"id":{"type":"integer"},"at":{"type":["string","null"],"format":"date-time"}},"required":["id","at"]}`,
+		},
+		{
+			name:   "no schema",
+			format: SchemaNone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "data.tsv")
+			if err := os.WriteFile(source, []byte("id\tat\n1\t2024-01-31T08:00:00Z\n2\t\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			destination := filepath.Join(dir, "out", "file.csv")
+			results, err := NewRegistry(WithSchemaFormat(tt.format)).ConvertFile(context.Background(), source, destination, Options{Output: FormatCSV})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(dir, "out", "file.schema.json")
+			b, err := os.ReadFile(path)
+			if tt.expected == "" {
+				if !errors.Is(err, os.ErrNotExist) || results[0].SchemaPath != "" {
+					t.Errorf("expected no schema to be written, got = %s", results[0].SchemaPath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[0].SchemaPath != path {
+				t.Errorf("expected schema path to be = %s, got = %s", path, results[0].SchemaPath)
+			}
+
+			var got, expected interface{}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.expected), &expected); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected schema to be = %s, got = %s", tt.expected, b)
+			}
+		})
+	}
+}
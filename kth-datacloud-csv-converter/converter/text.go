@@ -0,0 +1,162 @@
+package converter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+// recordReader reads the records of text input.
+type recordReader interface {
+	// Read returns the next record, it returns io.EOF when there are no records left.
+	// A blank line is a record of a single empty field.
+	Read() ([]string, error)
+
+	// Line returns the line the last record read starts on.
+	Line() int
+}
+
+// textReader reads the records of delimited text written in a dialect.
+type textReader struct {
+	r         *bufio.Reader
+	delimiter rune
+
+	// quote is the character quoted fields start with, zero when fields are never quoted.
+	quote rune
+
+	// backslash makes a backslash escape the next character inside quoted fields,
+	// otherwise quotes inside quoted fields are doubled.
+	backslash bool
+
+	// line is the line the reader is at, starting at 1.
+	line int
+
+	// start is the line the last record read starts on.
+	start int
+}
+
+// newTextReader returns a reader of the delimited text read from r in dialect.
+func newTextReader(r *bufio.Reader, dialect Dialect) *textReader {
+	delimiter, _ := utf8.DecodeRuneInString(dialect.Delimiter)
+	quote, _ := utf8.DecodeRuneInString(dialect.Quote)
+	if dialect.Quote == "" {
+		quote = 0
+	}
+
+	return &textReader{
+		r:         r,
+		delimiter: delimiter,
+		quote:     quote,
+		backslash: dialect.Escape == EscapeBackslash,
+		line:      1,
+	}
+}
+
+func (t *textReader) Line() int {
+	return t.start
+}
+
+// Read returns the fields up to the next line terminator outside of quotes.
+func (t *textReader) Read() ([]string, error) {
+	t.start = t.line
+
+	// A record needs at least one character, at the end of the input there are none left.
+	if _, _, err := t.r.ReadRune(); err != nil {
+		return nil, err
+	}
+	if err := t.r.UnreadRune(); err != nil {
+		return nil, err
+	}
+
+	var (
+		record []string
+		field  strings.Builder
+	)
+	for {
+		r, _, err := t.r.ReadRune()
+		if err == nil && t.quote != 0 && r == t.quote {
+			if err := t.readQuoted(&field); err != nil {
+				return nil, err
+			}
+			r, _, err = t.r.ReadRune()
+		}
+
+		// Unquoted fields, and whatever follows the closing quote, run until the next delimiter or line terminator.
+		for ; err == nil; r, _, err = t.r.ReadRune() {
+			if r == t.delimiter || r == '\n' || r == '\r' {
+				break
+			}
+			field.WriteRune(r)
+		}
+
+		record = append(record, field.String())
+		field.Reset()
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return record, nil
+			}
+			return nil, err
+		}
+
+		switch r {
+		case '\r':
+			// A carriage return ends the line on its own or together with a line feed.
+			if next, _, err := t.r.ReadRune(); err == nil && next != '\n' {
+				t.r.UnreadRune()
+			}
+			t.line++
+			return record, nil
+		case '\n':
+			t.line++
+			return record, nil
+		}
+	}
+}
+
+// readQuoted reads a quoted field up to and including its closing quote.
+func (t *textReader) readQuoted(field *strings.Builder) error {
+	start := t.line
+	for {
+		r, _, err := t.r.ReadRune()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("quoted field starting on line %d is never closed: %w", start, domain.ErrBadRequest)
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case r == '\n':
+			t.line++
+		case t.backslash && r == '\\':
+			next, _, err := t.r.ReadRune()
+			if err != nil {
+				return fmt.Errorf("quoted field starting on line %d is never closed: %w", start, domain.ErrBadRequest)
+			}
+			if next != t.quote && next != '\\' {
+				field.WriteRune(r)
+			}
+			if next == '\n' {
+				t.line++
+			}
+			r = next
+		case r == t.quote:
+			next, _, err := t.r.ReadRune()
+			if err == nil && !t.backslash && next == t.quote {
+				break
+			}
+			if err == nil {
+				t.r.UnreadRune()
+			}
+			return nil
+		}
+
+		field.WriteRune(r)
+	}
+}
@@ -0,0 +1,86 @@
+package converter
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// tsvEscapes maps the character after a backslash to the character it escapes in tab separated text.
+var tsvEscapes = map[byte]byte{
+	't':  '\t',
+	'n':  '\n',
+	'r':  '\r',
+	'\\': '\\',
+}
+
+// tsvReader reads tab separated text as defined by IANA: every line is a record and fields are separated
+// by tabs, so fields cannot hold tabs or line breaks. They are taken from the common backslash escapes
+// \t, \n, \r and \\ instead. Fields are kept as they are otherwise, whitespace and quotes included.
+type tsvReader struct {
+	r *bufio.Reader
+
+	// terminator ends a line, a line feed ending a line is preceded by an optional carriage return.
+	terminator byte
+
+	// line is the line of the last record read.
+	line int
+}
+
+// newTSVReader returns a reader of the tab separated text read from r, with lines ending as in dialect.
+func newTSVReader(r *bufio.Reader, dialect Dialect) *tsvReader {
+	terminator := byte('\n')
+	if dialect.LineTerminator == "\r" {
+		terminator = '\r'
+	}
+
+	return &tsvReader{
+		r:          r,
+		terminator: terminator,
+	}
+}
+
+func (t *tsvReader) Line() int {
+	return t.line
+}
+
+// Read returns the fields of the next line, the last line does not need a line terminator.
+func (t *tsvReader) Read() ([]string, error) {
+	line, err := t.r.ReadString(t.terminator)
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return nil, err
+	}
+	t.line++
+
+	line = strings.TrimSuffix(line, string(t.terminator))
+	if t.terminator == '\n' {
+		line = strings.TrimSuffix(line, "\r")
+	}
+
+	fields := strings.Split(line, "\t")
+	for i, field := range fields {
+		fields[i] = unescapeTSV(field)
+	}
+	return fields, nil
+}
+
+// unescapeTSV replaces the backslash escapes in field, unknown escapes are kept as they are.
+func unescapeTSV(field string) string {
+	if strings.IndexByte(field, '\\') < 0 {
+		return field
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+1 < len(field) {
+			if c, ok := tsvEscapes[field[i+1]]; ok {
+				b.WriteByte(c)
+				i++
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
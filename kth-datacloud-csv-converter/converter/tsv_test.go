@@ -0,0 +1,99 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnescapeTSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    string
+		expected string
+	}{
+		{name: "no escapes", field: "plain text", expected: "plain text"},
+		{name: "tab and line breaks", field: `a\tb\nc\rd`, expected: "a\tb\nc\rd"},
+		{name: "escaped backslash", field: `C:\\temp`, expected: `C:\temp`},
+		{name: "escaped backslash before a letter", field: `\\n`, expected: `\n`},
+		{name: "unknown escape", field: `\d+`, expected: `\d+`},
+		{name: "trailing backslash", field: `end\`, expected: `end\`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unescapeTSV(tt.field); got != tt.expected {
+				t.Errorf("expected field to be = %q, got = %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTSVConvert(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		expectedRes Result
+	}{
+		{
+			name:        "ragged rows are written and listed",
+			input:       "a\tb\tc\n1\t2\t3\n4\t5\n6\t7\t8\t9\n",
+			expected:    "a,b,c\n1,2,3\n4,5\n6,7,8,9\n",
+			expectedRes: Result{RowsRead: 4, RowsWritten: 4, RaggedRows: 2, Ragged: []Ragged{{Line: 3, Fields: 2, Expected: 3}, {Line: 4, Fields: 4, Expected: 3}}},
+		},
+		{
+			name:        "blank lines are read but not written",
+			input:       "a\tb\n\n1\t2\n\n",
+			expected:    "a,b\n1,2\n",
+			expectedRes: Result{RowsRead: 4, RowsWritten: 2},
+		},
+		{
+			name:        "escapes are replaced and quotes kept",
+			input:       "text\tpath\n\"quoted\" a\\tb\tC:\\\\temp\nline\\nbreak\t \n",
+			expected:    "text,path\n\"\"\"quoted\"\" a\tb\",C:\\temp\n\"line\nbreak\",\" \"\n",
+			expectedRes: Result{RowsRead: 3, RowsWritten: 3},
+		},
+		{
+			name:        "lines ending with carriage returns and line feeds, the last without",
+			input:       "a\tb\r\n1\t2\r\n3\t4",
+			expected:    "a,b\n1,2\n3,4\n",
+			expectedRes: Result{RowsRead: 3, RowsWritten: 3},
+		},
+		{
+			name:        "lines ending with carriage returns",
+			input:       "a\tb\r1\t2\r",
+			expected:    "a,b\n1,2\n",
+			expectedRes: Result{RowsRead: 2, RowsWritten: 2},
+		},
+		{
+			name:        "comma separated input is read as quoted text",
+			input:       "a,b\n\"1,5\",2\n3,4\n",
+			expected:    "a,b\n\"1,5\",2\n3,4\n",
+			expectedRes: Result{RowsRead: 3, RowsWritten: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			result, err := tsvConverter{sampleSize: DefaultSampleSize}.Convert(context.Background(), strings.NewReader(tt.input), &out, Options{Input: FormatTSV})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("expected output to be = %q, got = %q", tt.expected, out.String())
+			}
+
+			if result.RowsRead != tt.expectedRes.RowsRead || result.RowsWritten != tt.expectedRes.RowsWritten {
+				t.Errorf("expected rows to be = %d read and %d written, got = %d read and %d written",
+					tt.expectedRes.RowsRead, tt.expectedRes.RowsWritten, result.RowsRead, result.RowsWritten)
+			}
+			if result.RaggedRows != tt.expectedRes.RaggedRows || !reflect.DeepEqual(result.Ragged, tt.expectedRes.Ragged) {
+				t.Errorf("expected ragged rows to be = %d %+v, got = %d %+v", tt.expectedRes.RaggedRows, tt.expectedRes.Ragged, result.RaggedRows, result.Ragged)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package converter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+// ColumnType is the type of the values of a column, named as in the Frictionless Table Schema.
+type ColumnType string
+
+const (
+	// TypeInteger is a whole number of 64 bits.
+	TypeInteger = ColumnType("integer")
+
+	// TypeNumber is a decimal number, written with a decimal point.
+	TypeNumber = ColumnType("number")
+
+	// TypeBoolean is true or false.
+	TypeBoolean = ColumnType("boolean")
+
+	// TypeDate is a calendar date in ISO 8601, such as 2024-01-31.
+	TypeDate = ColumnType("date")
+
+	// TypeDateTime is a timestamp in ISO 8601, such as 2024-01-31T13:45:00Z. The time zone is UTC
+	// when it is left out, and a date is a timestamp at midnight.
+	TypeDateTime = ColumnType("datetime")
+
+	// TypeString is text, which any value is.
+	TypeString = ColumnType("string")
+)
+
+// columnTypes are the types a column can have, in the order they are inferred.
+var columnTypes = []ColumnType{TypeInteger, TypeNumber, TypeBoolean, TypeDate, TypeDateTime, TypeString}
+
+// widenings are the types a column of a type widens to when a value does not fit, before it becomes
+// a string column. The wider type accepts every value of the narrower one.
+var widenings = map[ColumnType]ColumnType{
+	TypeInteger: TypeNumber,
+	TypeDate:    TypeDateTime,
+}
+
+// dateTimeLayouts are the layouts of timestamps, without time zone they are in UTC.
+// Fractional seconds are accepted by every layout with seconds.
+var dateTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// valid reports whether t is a known column type.
+func (t ColumnType) valid() bool {
+	for _, c := range columnTypes {
+		if t == c {
+			return true
+		}
+	}
+	return false
+}
+
+// accepts reports whether value is of the type, empty values are nulls of every type.
+func (t ColumnType) accepts(value string) bool {
+	if value == "" {
+		return true
+	}
+
+	switch t {
+	case "":
+		return false
+	case TypeInteger:
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil && !leadingZero(value)
+	case TypeNumber:
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil && !leadingZero(value) && strings.Trim(value, "+-0123456789.eE") == ""
+	case TypeBoolean:
+		_, err := parseBool(value)
+		return err == nil
+	case TypeDate:
+		_, err := parseDate(value)
+		return err == nil
+	case TypeDateTime:
+		_, err := parseDateTime(value)
+		return err == nil
+	default:
+		return true
+	}
+}
+
+// leadingZero reports whether the number is written with leading zeros, such as postal codes and
+// identifiers, which are lost when it is stored as a number.
+func leadingZero(value string) bool {
+	value = strings.TrimLeft(value, "+-")
+	return len(value) > 1 && value[0] == '0' && value[1] != '.'
+}
+
+// parseBool parses true and false in any case.
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %q", value)
+	}
+}
+
+// parseDate parses a date in ISO 8601.
+func parseDate(value string) (time.Time, error) {
+	return time.Parse("2006-01-02", value)
+}
+
+// parseDateTime parses a timestamp in one of the dateTimeLayouts.
+func parseDateTime(value string) (time.Time, error) {
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// widen returns the type of a column of type t having value, which is t when the value fits.
+// A column without values yet, of the empty type, takes the type of its first value.
+func widen(t ColumnType, value string) ColumnType {
+	if t.accepts(value) {
+		return t
+	}
+
+	if t == "" {
+		for _, c := range columnTypes {
+			if c.accepts(value) {
+				return c
+			}
+		}
+	}
+
+	for w, ok := widenings[t]; ok; w, ok = widenings[w] {
+		if w.accepts(value) {
+			return w
+		}
+	}
+	return TypeString
+}
+
+// columnType returns the type of the column with the given name supplied in the options,
+// the inferred type when none is supplied.
+func columnType(name string, inferred ColumnType, options Options) (ColumnType, error) {
+	t, ok := options.ColumnTypes[name]
+	if !ok {
+		return inferred, nil
+	}
+	if !t.valid() {
+		return "", fmt.Errorf("invalid type %q of column %q: %w", t, name, domain.ErrBadRequest)
+	}
+	return t, nil
+}
@@ -0,0 +1,241 @@
+package converter
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+// SheetConverter converts every sheet of a workbook into a file of its own.
+type SheetConverter interface {
+	// ConvertSheets converts the sheets of the workbook read from r into files created by create,
+	// named after the sheet. The results are in the order of the sheets.
+	ConvertSheets(ctx context.Context, r io.Reader, create func(sheet string) (io.Writer, error), options Options) ([]Result, error)
+}
+
+// workbook is a spreadsheet document holding sheets of cells.
+type workbook interface {
+	// sheets returns the names of the sheets, in order.
+	sheets() []string
+
+	// rows returns the rows of the sheet at index, starting at the first row of the sheet.
+	// The cells of merged ranges hold the value of the range.
+	rows(index int) ([][]string, error)
+}
+
+// Limits of the size of a sheet, the rows, columns and length of cells are those of Excel. Sheets are
+// held in memory, so the number of cells up to the last cell of each row is limited as well.
+const (
+	maxSheetRows  = 1 << 20 // 1048576.
+	maxSheetCols  = 1 << 14 // 16384, column XFD.
+	maxSheetCells = 1 << 24
+	maxCellText   = 32767
+)
+
+var (
+	// errSheetTooLarge is returned when a sheet holds cells beyond the limits of a sheet.
+	errSheetTooLarge = fmt.Errorf("sheet is larger than %d rows, %d columns or %d cells: %w", maxSheetRows, maxSheetCols, maxSheetCells, domain.ErrBadRequest)
+	// errCellTooLarge is returned when the text of a cell is longer than the limit of a cell.
+	errCellTooLarge = fmt.Errorf("cell is longer than %d characters: %w", maxCellText, domain.ErrBadRequest)
+)
+
+// cellRange is a range of cells, from the first to the last row and column, counted from zero.
+type cellRange struct {
+	firstRow, firstCol int
+	lastRow, lastCol   int
+}
+
+// workbookConverter converts the sheets of a spreadsheet document into CSV.
+type workbookConverter struct {
+	open func(r *zip.Reader) (workbook, error)
+}
+
+// Convert converts the sheet selected by name or index in the options, the first sheet when none is selected.
+func (c workbookConverter) Convert(ctx context.Context, r io.Reader, w io.Writer, options Options) (Result, error) {
+	wb, err := c.openWorkbook(r, options)
+	if err != nil {
+		return Result{}, err
+	}
+
+	index, err := selectSheet(wb.sheets(), options.Sheet)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return convertSheet(ctx, wb, index, w)
+}
+
+func (c workbookConverter) ConvertSheets(ctx context.Context, r io.Reader, create func(sheet string) (io.Writer, error), options Options) ([]Result, error) {
+	wb, err := c.openWorkbook(r, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for i, name := range wb.sheets() {
+		w, err := create(name)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := convertSheet(ctx, wb, i, w)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// openWorkbook opens the workbook read from r.
+func (c workbookConverter) openWorkbook(r io.Reader, options Options) (workbook, error) {
+	ra, size, err := readerAt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s workbook: %v: %w", options.Input, err, domain.ErrBadRequest)
+	}
+
+	return c.open(zr)
+}
+
+// selectSheet returns the index of the sheet with the given name, or the given index counted from zero.
+// The first sheet is selected when sheet is empty.
+func selectSheet(names []string, sheet string) (int, error) {
+	if len(names) == 0 {
+		return 0, fmt.Errorf("workbook has no sheets: %w", domain.ErrBadRequest)
+	}
+	if sheet == "" {
+		return 0, nil
+	}
+
+	for i, name := range names {
+		if name == sheet {
+			return i, nil
+		}
+	}
+
+	if i, err := strconv.Atoi(sheet); err == nil && i >= 0 && i < len(names) {
+		return i, nil
+	}
+	return 0, fmt.Errorf("workbook has no sheet %q: %w", sheet, domain.ErrBadRequest)
+}
+
+// convertSheet writes the rows of the sheet at index as CSV. Every row is as wide as the widest row,
+// rows without values are read but not written.
+func convertSheet(ctx context.Context, wb workbook, index int, w io.Writer) (Result, error) {
+	rows, err := wb.rows(index)
+	if err != nil {
+		return Result{}, err
+	}
+
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	result := Result{Format: FormatCSV, Sheet: wb.sheets()[index]}
+	writer := csv.NewWriter(w)
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+
+		result.RowsRead++
+		if len(row) == 0 {
+			continue
+		}
+
+		record := make([]string, width)
+		copy(record, row)
+		if err := writer.Write(record); err != nil {
+			return Result{}, err
+		}
+		result.RowsWritten++
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// sheetCells are the rows of a sheet up to their last cell holding a value, within the limits of a sheet.
+type sheetCells struct {
+	rows [][]string
+
+	// cells is the number of cells of the rows.
+	cells int
+}
+
+// set sets the cell at row and col to value, growing the rows as needed.
+func (s *sheetCells) set(row, col int, value string) error {
+	if row < 0 || col < 0 || row >= maxSheetRows || col >= maxSheetCols {
+		return errSheetTooLarge
+	}
+
+	for len(s.rows) <= row {
+		s.rows = append(s.rows, nil)
+	}
+	if n := col + 1 - len(s.rows[row]); n > 0 {
+		if s.cells += n; s.cells > maxSheetCells {
+			return errSheetTooLarge
+		}
+		s.rows[row] = append(s.rows[row], make([]string, n)...)
+	}
+	s.rows[row][col] = value
+	return nil
+}
+
+// fillMerged copies the value of the first cell of every merged range into the other cells of the range,
+// so every row holds its own values. Ranges are clipped to the rows and columns holding values, as those
+// spanning whole rows or columns would fill the sheet up to its limits.
+func (s *sheetCells) fillMerged(merged []cellRange) error {
+	width := 0
+	for _, row := range s.rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	// Ranges may overlap, so the cells they fill are limited as well.
+	filled := 0
+	for _, m := range merged {
+		if m.firstRow >= len(s.rows) || m.firstCol >= len(s.rows[m.firstRow]) || s.rows[m.firstRow][m.firstCol] == "" {
+			continue
+		}
+
+		lastRow, lastCol := m.lastRow, m.lastCol
+		if lastRow >= len(s.rows) {
+			lastRow = len(s.rows) - 1
+		}
+		if lastCol >= width {
+			lastCol = width - 1
+		}
+		if filled += (lastRow - m.firstRow + 1) * (lastCol - m.firstCol + 1); filled > maxSheetCells {
+			return errSheetTooLarge
+		}
+
+		value := s.rows[m.firstRow][m.firstCol]
+		for row := m.firstRow; row <= lastRow; row++ {
+			for col := m.firstCol; col <= lastCol; col++ {
+				if err := s.set(row, col, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+func TestSelectSheet(t *testing.T) {
+	names := []string{"Data", "2", "Notes"}
+
+	tests := []struct {
+		name        string
+		sheet       string
+		names       []string
+		expected    int
+		expectedErr error
+	}{
+		{name: "first sheet when none is selected", names: names, expected: 0},
+		{name: "by name", sheet: "Notes", names: names, expected: 2},
+		{name: "name before index", sheet: "2", names: names, expected: 1},
+		{name: "by index", sheet: "0", names: names, expected: 0},
+		{name: "unknown name", sheet: "Summary", names: names, expectedErr: domain.ErrBadRequest},
+		{name: "index out of range", sheet: "3", names: names, expectedErr: domain.ErrBadRequest},
+		{name: "no sheets", names: nil, expectedErr: domain.ErrBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, err := selectSheet(tt.names, tt.sheet)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err == nil && index != tt.expected {
+				t.Errorf("expected index to be = %d, got = %d", tt.expected, index)
+			}
+		})
+	}
+}
+
+func TestConvertSheets(t *testing.T) {
+	archive := xlsxArchive(t, map[string]string{
+		xlsxWorkbook:               `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="First" sheetId="1" r:id="rId1"/><sheet name="Second" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		xlsxRelationships:          `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData><row r="1"><c r="A1"><v>1</v></c></row><row r="3"><c r="B3"><v>2</v></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>x</t></is></c></row></sheetData></worksheet>`,
+	})
+
+	tests := []struct {
+		name            string
+		options         Options
+		expected        []string
+		expectedResults []Result
+	}{
+		{
+			name:            "first sheet",
+			options:         Options{Input: FormatXLSX},
+			expected:        []string{"1,\n,2\n"},
+			expectedResults: []Result{{Format: FormatCSV, Sheet: "First", RowsRead: 3, RowsWritten: 2}},
+		},
+		{
+			name:            "sheet by name",
+			options:         Options{Input: FormatXLSX, Sheet: "Second"},
+			expected:        []string{"x\n"},
+			expectedResults: []Result{{Format: FormatCSV, Sheet: "Second", RowsRead: 1, RowsWritten: 1}},
+		},
+		{
+			name:     "all sheets",
+			options:  Options{Input: FormatXLSX, AllSheets: true},
+			expected: []string{"1,\n,2\n", "x\n"},
+			expectedResults: []Result{
+				{Format: FormatCSV, Sheet: "First", RowsRead: 3, RowsWritten: 2},
+				{Format: FormatCSV, Sheet: "Second", RowsRead: 1, RowsWritten: 1},
+			},
+		},
+	}
+
+	c := workbookConverter{open: openXLSX}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				outs    []*bytes.Buffer
+				results []Result
+				err     error
+			)
+			if tt.options.AllSheets {
+				results, err = c.ConvertSheets(context.Background(), bytes.NewReader(archive), func(sheet string) (io.Writer, error) {
+					outs = append(outs, &bytes.Buffer{})
+					return outs[len(outs)-1], nil
+				}, tt.options)
+			} else {
+				outs = []*bytes.Buffer{{}}
+				var result Result
+				result, err = c.Convert(context.Background(), bytes.NewReader(archive), outs[0], tt.options)
+				results = []Result{result}
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, out := range outs {
+				got = append(got, out.String())
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected output to be = %q, got = %q", tt.expected, got)
+			}
+			if !reflect.DeepEqual(results, tt.expectedResults) {
+				t.Errorf("expected results to be = %+v, got = %+v", tt.expectedResults, results)
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+package converter
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+const (
+	xlsxWorkbook      = "xl/workbook.xml"
+	xlsxRelationships = "xl/_rels/workbook.xml.rels"
+	xlsxSharedStrings = "xl/sharedStrings.xml"
+	xlsxStyles        = "xl/styles.xml"
+)
+
+// numberKind is how a number format shows a number.
+type numberKind int
+
+const (
+	kindNumber numberKind = iota
+	kindDate
+	kindTime
+	kindDateTime
+)
+
+// builtinKinds are the built-in number formats of Excel showing dates and times, by number format ID.
+var builtinKinds = map[int]numberKind{
+	14: kindDate, 15: kindDate, 16: kindDate, 17: kindDate,
+	18: kindTime, 19: kindTime, 20: kindTime, 21: kindTime,
+	22: kindDateTime,
+	45: kindTime, 46: kindTime, 47: kindTime,
+}
+
+func init() {
+	// Dates of the East Asian locales.
+	for id := 27; id <= 36; id++ {
+		builtinKinds[id] = kindDate
+	}
+	for id := 50; id <= 58; id++ {
+		builtinKinds[id] = kindDate
+	}
+}
+
+var (
+	// epoch1900 is day zero of workbooks in the 1900 date system, which counts 1900 as a leap year.
+	epoch1900 = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+	// epoch1904 is day zero of workbooks in the 1904 date system, used by old Excel for Mac.
+	epoch1904 = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// xlsxWorkbookFile is the part of xl/workbook.xml listing the sheets.
+type xlsxWorkbookFile struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name  string     `xml:"name,attr"`
+		Attrs []xml.Attr `xml:",any,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// xlsxRelationshipsFile maps relationship IDs to the parts of the workbook.
+type xlsxRelationshipsFile struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxString is a shared or inline string, either plain text or runs of rich text.
+// Phonetic runs are not part of the text.
+type xlsxString struct {
+	T *string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (s xlsxString) text() string {
+	if s.T != nil {
+		return *s.T
+	}
+
+	var b strings.Builder
+	for _, r := range s.R {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+// xlsxStylesFile is the part of xl/styles.xml telling the number format of each cell style.
+type xlsxStylesFile struct {
+	NumberFormats []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellFormats []struct {
+		NumberFormatID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+// xlsxCell is a cell of a sheet. A formula cell holds the value cached when the workbook was saved.
+type xlsxCell struct {
+	Ref    string      `xml:"r,attr"`
+	Style  int         `xml:"s,attr"`
+	Type   string      `xml:"t,attr"`
+	Value  *string     `xml:"v"`
+	Inline *xlsxString `xml:"is"`
+}
+
+// xlsxSheet is a sheet of the workbook and the part holding its cells.
+type xlsxSheet struct {
+	name string
+	part string
+}
+
+// xlsxBook is an Office Open XML workbook, as written by Excel.
+type xlsxBook struct {
+	zr       *zip.Reader
+	sheetsOf []xlsxSheet
+
+	// shared are the shared strings, which text cells refer to by index.
+	shared []string
+
+	// styles are the kinds of the number formats of the cell styles, by style index.
+	styles []numberKind
+
+	epoch time.Time
+}
+
+// openXLSX reads the sheets, shared strings and styles of an Office Open XML workbook.
+func openXLSX(zr *zip.Reader) (workbook, error) {
+	var wb xlsxWorkbookFile
+	if err := readXML(zr, xlsxWorkbook, &wb); err != nil {
+		return nil, err
+	}
+
+	var rels xlsxRelationshipsFile
+	if err := readXML(zr, xlsxRelationships, &rels); err != nil {
+		return nil, err
+	}
+	targets := map[string]string{}
+	for _, r := range rels.Relationships {
+		targets[r.ID] = r.Target
+	}
+
+	book := &xlsxBook{zr: zr, epoch: epoch1900}
+	if wb.Properties.Date1904 {
+		book.epoch = epoch1904
+	}
+
+	for _, s := range wb.Sheets {
+		var target string
+		for _, a := range s.Attrs {
+			// The relationship namespace differs between transitional and strict workbooks.
+			if a.Name.Local == "id" {
+				target = targets[a.Value]
+			}
+		}
+		if target == "" {
+			return nil, fmt.Errorf("sheet %q has no part: %w", s.Name, domain.ErrBadRequest)
+		}
+
+		// Targets are relative to the workbook part, unless they are absolute.
+		part := path.Join(path.Dir(xlsxWorkbook), target)
+		if strings.HasPrefix(target, "/") {
+			part = strings.TrimPrefix(target, "/")
+		}
+		book.sheetsOf = append(book.sheetsOf, xlsxSheet{name: s.Name, part: part})
+	}
+
+	// Workbooks without text or styles leave out their parts.
+	var sst struct {
+		Items []xlsxString `xml:"si"`
+	}
+	if err := readXML(zr, xlsxSharedStrings, &sst); err != nil && !errors.Is(err, errMissingPart) {
+		return nil, err
+	}
+	for _, si := range sst.Items {
+		book.shared = append(book.shared, si.text())
+	}
+
+	var styles xlsxStylesFile
+	if err := readXML(zr, xlsxStyles, &styles); err != nil && !errors.Is(err, errMissingPart) {
+		return nil, err
+	}
+	custom := map[int]numberKind{}
+	for _, f := range styles.NumberFormats {
+		custom[f.ID] = formatKind(f.Code)
+	}
+	for _, xf := range styles.CellFormats {
+		kind, ok := custom[xf.NumberFormatID]
+		if !ok {
+			kind = builtinKinds[xf.NumberFormatID]
+		}
+		book.styles = append(book.styles, kind)
+	}
+
+	return book, nil
+}
+
+func (b *xlsxBook) sheets() []string {
+	names := make([]string, len(b.sheetsOf))
+	for i, s := range b.sheetsOf {
+		names[i] = s.name
+	}
+	return names
+}
+
+// rows returns the cells of the sheet holding values. The part of the sheet is decoded cell by cell rather
+// than at once, as most of it is markup, and the values are kept within the limits of a sheet.
+func (b *xlsxBook) rows(index int) ([][]string, error) {
+	f, err := b.zr.Open(b.sheetsOf[index].part)
+	if err != nil {
+		return nil, fmt.Errorf("sheet %q is missing: %v: %w", b.sheetsOf[index].name, err, domain.ErrBadRequest)
+	}
+	defer f.Close()
+
+	var (
+		cells  sheetCells
+		merged []cellRange
+		row    = -1
+		col    = -1
+	)
+	d := xml.NewDecoder(f)
+	for {
+		token, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sheet %q: %v: %w", b.sheetsOf[index].name, err, domain.ErrBadRequest)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "row":
+			// Rows and cells leave out their reference when they follow the previous one.
+			row, col = row+1, -1
+			for _, a := range start.Attr {
+				if a.Name.Local == "r" {
+					if r, err := strconv.Atoi(a.Value); err == nil && r > 0 {
+						row = r - 1
+					}
+				}
+			}
+		case "c":
+			var cell xlsxCell
+			if err := d.DecodeElement(&cell, &start); err != nil {
+				return nil, fmt.Errorf("failed to read sheet %q: %v: %w", b.sheetsOf[index].name, err, domain.ErrBadRequest)
+			}
+
+			col++
+			if r, c, ok := parseCellRef(cell.Ref); ok {
+				row, col = r, c
+			}
+
+			value, err := b.value(cell)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read cell %s of sheet %q: %w", cell.Ref, b.sheetsOf[index].name, err)
+			}
+			if value != "" && row >= 0 {
+				if err := cells.set(row, col, value); err != nil {
+					return nil, fmt.Errorf("failed to read cell %s of sheet %q: %w", cell.Ref, b.sheetsOf[index].name, err)
+				}
+			}
+		case "mergeCell":
+			for _, a := range start.Attr {
+				if a.Name.Local == "ref" {
+					if m, ok := parseRangeRef(a.Value); ok {
+						merged = append(merged, m)
+					}
+				}
+			}
+		}
+	}
+
+	if err := cells.fillMerged(merged); err != nil {
+		return nil, fmt.Errorf("failed to read sheet %q: %w", b.sheetsOf[index].name, err)
+	}
+	return cells.rows, nil
+}
+
+// value returns the cell as text. Numbers formatted as dates or times are written in ISO 8601.
+func (b *xlsxBook) value(cell xlsxCell) (string, error) {
+	if cell.Type == "inlineStr" {
+		if cell.Inline == nil {
+			return "", nil
+		}
+		return cell.Inline.text(), nil
+	}
+	if cell.Value == nil {
+		return "", nil
+	}
+
+	v := *cell.Value
+	switch cell.Type {
+	case "s":
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 || i >= len(b.shared) {
+			return "", fmt.Errorf("invalid shared string %q: %w", v, domain.ErrBadRequest)
+		}
+		return b.shared[i], nil
+	case "b":
+		if v == "1" {
+			return "true", nil
+		}
+		return "false", nil
+	case "str", "e", "d":
+		// Formula text, errors such as #DIV/0! and dates already written in ISO 8601.
+		return v, nil
+	}
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid number %q: %w", v, domain.ErrBadRequest)
+	}
+
+	kind := kindNumber
+	if cell.Style >= 0 && cell.Style < len(b.styles) {
+		kind = b.styles[cell.Style]
+	}
+	if kind == kindNumber {
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	}
+	return b.formatDate(n, kind), nil
+}
+
+// formatDate writes the serial date n in ISO 8601, a date without time of day is written as a date.
+func (b *xlsxBook) formatDate(n float64, kind numberKind) string {
+	days := math.Floor(n)
+	seconds := math.Round((n - days) * 24 * 60 * 60)
+	if b.epoch.Equal(epoch1900) && days < 60 {
+		// Excel counts 29 February 1900, which never was, so earlier days are one off.
+		days++
+	}
+	t := b.epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+
+	switch {
+	case kind == kindTime:
+		return t.Format("15:04:05")
+	case kind == kindDate && seconds == 0:
+		return t.Format("2006-01-02")
+	default:
+		return t.Format("2006-01-02T15:04:05")
+	}
+}
+
+// formatKind returns how the number format code shows numbers. Codes with years or days show dates,
+// codes with hours or seconds show times, and months are minutes next to hours or seconds.
+func formatKind(code string) numberKind {
+	// Only the format of positive numbers counts, quoted text, escaped characters and colors do not.
+	if i := strings.Index(code, ";"); i >= 0 {
+		code = code[:i]
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; c {
+		case '"':
+			if j := strings.IndexByte(code[i+1:], '"'); j >= 0 {
+				i += j + 1
+			}
+		case '\\', '_', '*':
+			i++
+		case '[':
+			if j := strings.IndexByte(code[i:], ']'); j >= 0 {
+				// Elapsed hours, minutes and seconds are in brackets.
+				if inner := strings.ToLower(code[i+1 : i+j]); strings.Trim(inner, "hms") == "" {
+					b.WriteString(inner)
+				}
+				i += j
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	code = strings.ToLower(b.String())
+	date := strings.ContainsAny(code, "yd")
+	clock := strings.ContainsAny(code, "hs")
+	switch {
+	case date && clock:
+		return kindDateTime
+	case date:
+		return kindDate
+	case clock:
+		return kindTime
+	case strings.Contains(code, "m"):
+		return kindDate
+	default:
+		return kindNumber
+	}
+}
+
+// parseCellRef returns the row and column of a cell reference such as B3, counted from zero.
+// References beyond the limits of a sheet are invalid.
+func parseCellRef(ref string) (int, int, bool) {
+	ref = strings.ReplaceAll(ref, "$", "")
+
+	col, i := 0, 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A'+1)
+		if col > maxSheetCols {
+			return 0, 0, false
+		}
+	}
+
+	row, err := strconv.Atoi(ref[i:])
+	if i == 0 || err != nil || row < 1 || row > maxSheetRows {
+		return 0, 0, false
+	}
+	return row - 1, col - 1, true
+}
+
+// parseRangeRef returns the range of a reference such as A1:C2.
+func parseRangeRef(ref string) (cellRange, bool) {
+	first, last, _ := strings.Cut(ref, ":")
+	if last == "" {
+		last = first
+	}
+
+	firstRow, firstCol, ok := parseCellRef(first)
+	if !ok {
+		return cellRange{}, false
+	}
+	lastRow, lastCol, ok := parseCellRef(last)
+	if !ok {
+		return cellRange{}, false
+	}
+	return cellRange{firstRow: firstRow, firstCol: firstCol, lastRow: lastRow, lastCol: lastCol}, true
+}
+
+// errMissingPart is returned when a part of a workbook is missing.
+var errMissingPart = fmt.Errorf("workbook part is missing: %w", domain.ErrBadRequest)
+
+// readXML decodes the part with the given name of the workbook into v.
+func readXML(zr *zip.Reader, name string, v interface{}) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, errMissingPart)
+	}
+	defer f.Close()
+
+	if err := xml.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("failed to read %s: %v: %w", name, err, domain.ErrBadRequest)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+// xlsxWorkbookXML is the workbook part of a workbook with a single sheet named Sheet1.
+const xlsxWorkbookXML = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxRelationshipsXML = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`
+
+// xlsxStylesXML has the cell styles 0 general, 1 date, 2 date and time and 3 time of day.
+const xlsxStylesXML = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd hh:mm"/></numFmts><cellXfs count="4"><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="20"/></cellXfs></styleSheet>`
+
+// xlsxSharedStringsXML has the shared strings 0 plain and 1 rich text.
+const xlsxSharedStringsXML = `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><si><t>name</t></si><si><r><t>rich </t></r><r><rPr><b/></rPr><t>text</t></r><rPh><t>ignored</t></rPh></si></sst>`
+
+// xlsxArchive returns a workbook holding the parts by name.
+func xlsxArchive(t *testing.T, parts map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range parts {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// xlsxSheetArchive returns a workbook with a single sheet holding data, the content of sheetData.
+func xlsxSheetArchive(t *testing.T, data, extra string) []byte {
+	return xlsxArchive(t, map[string]string{
+		xlsxWorkbook:               xlsxWorkbookXML,
+		xlsxRelationships:          xlsxRelationshipsXML,
+		xlsxStyles:                 xlsxStylesXML,
+		xlsxSharedStrings:          xlsxSharedStringsXML,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + data + `</sheetData>` + extra + `</worksheet>`,
+	})
+}
+
+func TestParseCellRef(t *testing.T) {
+	tests := []struct {
+		name        string
+		ref         string
+		expectedRow int
+		expectedCol int
+		expectedOK  bool
+	}{
+		{name: "first cell", ref: "A1", expectedRow: 0, expectedCol: 0, expectedOK: true},
+		{name: "absolute", ref: "$B$3", expectedRow: 2, expectedCol: 1, expectedOK: true},
+		{name: "last cell of a sheet", ref: "XFD1048576", expectedRow: 1048575, expectedCol: 16383, expectedOK: true},
+		{name: "column beyond the sheet", ref: "XFE1"},
+		{name: "row beyond the sheet", ref: "A1048577"},
+		{name: "column overflowing int", ref: "ZZZZZZZZZZZZZZ1"},
+		{name: "no column", ref: "12"},
+		{name: "no row", ref: "A"},
+		{name: "row zero", ref: "A0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, col, ok := parseCellRef(tt.ref)
+			if ok != tt.expectedOK {
+				t.Fatalf("expected ok to be = %t, got = %t", tt.expectedOK, ok)
+			}
+			if ok && (row != tt.expectedRow || col != tt.expectedCol) {
+				t.Errorf("expected cell to be = %d,%d, got = %d,%d", tt.expectedRow, tt.expectedCol, row, col)
+			}
+		})
+	}
+}
+
+func TestFormatKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		expected numberKind
+	}{
+		{name: "general", code: "General", expected: kindNumber},
+		{name: "decimals", code: "#,##0.00", expected: kindNumber},
+		{name: "date", code: "yyyy-mm-dd", expected: kindDate},
+		{name: "month and year", code: "mmm yyyy", expected: kindDate},
+		{name: "date and time", code: "dd/mm/yyyy hh:mm", expected: kindDateTime},
+		{name: "time", code: "hh:mm:ss", expected: kindTime},
+		{name: "elapsed time", code: "[h]:mm", expected: kindTime},
+		{name: "quoted text", code: `0 "days"`, expected: kindNumber},
+		{name: "escaped characters", code: `0\ \d`, expected: kindNumber},
+		{name: "color and locale", code: "[Red][$-41D]yyyy-mm-dd", expected: kindDate},
+		{name: "negative numbers in another format", code: `0;"d"0`, expected: kindNumber},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if kind := formatKind(tt.code); kind != tt.expected {
+				t.Errorf("expected kind to be = %d, got = %d", tt.expected, kind)
+			}
+		})
+	}
+}
+
+func TestXLSXConvert(t *testing.T) {
+	tests := []struct {
+		name        string
+		archive     []byte
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "shared, rich and inline strings",
+			archive:  xlsxSheetArchive(t, `<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>inline</t></is></c></row>`, ""),
+			expected: "name,rich text,inline\n",
+		},
+		{
+			name:     "numbers and booleans",
+			archive:  xlsxSheetArchive(t, `<row r="1"><c r="A1"><v>1234.5</v></c><c r="B1"><v>1E-3</v></c><c r="C1" t="b"><v>1</v></c><c r="D1" t="b"><v>0</v></c></row>`, ""),
+			expected: "1234.5,0.001,true,false\n",
+		},
+		{
+			name:     "dates and times",
+			archive:  xlsxSheetArchive(t, `<row r="1"><c r="A1" s="1"><v>45000</v></c><c r="B1" s="2"><v>45000.5</v></c><c r="C1" s="3"><v>0.75</v></c><c r="D1" s="1"><v>1</v></c><c r="E1" t="d"><v>2023-03-15T08:00:00</v></c></row>`, ""),
+			expected: "2023-03-15,2023-03-15T12:00:00,18:00:00,1900-01-01,2023-03-15T08:00:00\n",
+		},
+		{
+			name:     "formulas hold their cached values",
+			archive:  xlsxSheetArchive(t, `<row r="1"><c r="A1"><v>1</v></c><c r="B1"><v>2</v></c><c r="C1"><f>A1+B1</f><v>3</v></c><c r="D1" t="str"><f>"x"&amp;A1</f><v>x1</v></c><c r="E1" t="e"><f>A1/0</f><v>#DIV/0!</v></c><c r="F1" s="1"><f>TODAY()</f><v>45000</v></c></row>`, ""),
+			expected: "1,2,3,x1,#DIV/0!,2023-03-15\n",
+		},
+		{
+			name:     "formulas without cached values are empty",
+			archive:  xlsxSheetArchive(t, `<row r="1"><c r="A1"><v>1</v></c><c r="B1"><f>A1*2</f></c><c r="C1"><v>3</v></c></row>`, ""),
+			expected: "1,,3\n",
+		},
+		{
+			name:     "merged cells hold the value of the range",
+			archive:  xlsxSheetArchive(t, `<row r="1"><c r="A1" t="inlineStr"><is><t>group</t></is></c><c r="C1" t="inlineStr"><is><t>c</t></is></c></row><row r="2"><c r="C2" t="inlineStr"><is><t>d</t></is></c></row><row r="3"><c r="A3"><v>1</v></c></row>`, `<mergeCells count="2"><mergeCell ref="A1:B2"/><mergeCell ref="A3:C3"/></mergeCells>`),
+			expected: "group,group,c\ngroup,group,d\n1,1,1\n",
+		},
+		{
+			name:     "rows and cells without references follow the previous ones",
+			archive:  xlsxSheetArchive(t, `<row><c><v>1</v></c><c><v>2</v></c></row><row r="4"><c r="B4"><v>3</v></c><c><v>4</v></c></row>`, ""),
+			expected: "1,2,\n,3,4\n",
+		},
+		{
+			name:        "invalid shared string",
+			archive:     xlsxSheetArchive(t, `<row r="1"><c r="A1" t="s"><v>7</v></c></row>`, ""),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "not a workbook",
+			archive:     []byte("a,b\n"),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:     "crafted reference does not crash",
+			archive:  xlsxSheetArchive(t, `<row r="1"><c r="ZZZZZZZZZZZZZZ1" t="inlineStr"><is><t>a</t></is></c></row>`, ""),
+			expected: "a\n",
+		},
+		{
+			name:     "merged range spanning the sheet is clipped to the values",
+			archive:  xlsxSheetArchive(t, `<row r="1"><c r="A1" t="inlineStr"><is><t>a</t></is></c><c r="B1" t="inlineStr"><is><t>b</t></is></c></row><row r="2"><c r="B2" t="inlineStr"><is><t>c</t></is></c></row>`, `<mergeCells count="1"><mergeCell ref="A1:XFD1048576"/></mergeCells>`),
+			expected: "a,a\na,a\n",
+		},
+		{
+			name:        "row beyond the sheet",
+			archive:     xlsxSheetArchive(t, `<row r="2000000000"><c t="inlineStr"><is><t>a</t></is></c></row>`, ""),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:     "last cell of the sheet",
+			archive:  xlsxSheetArchive(t, `<row r="1048576"><c r="XFD1048576" t="inlineStr"><is><t>a</t></is></c></row>`, ""),
+			expected: strings.Repeat(",", maxSheetCols-1) + "a\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			_, err := workbookConverter{open: openXLSX}.Convert(context.Background(), bytes.NewReader(tt.archive), &out, Options{Input: FormatXLSX})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err == nil && out.String() != tt.expected {
+				t.Errorf("expected output to be = %q, got = %q", tt.expected, out.String())
+			}
+		})
+	}
+}
@@ -1,83 +1,89 @@
 package event
 
 import (
-	"bufio"
 	"context"
-	"encoding/csv"
 	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/converter"
 )
 
 type publisher interface {
-	FileCreated(ctx context.Context, eventID string, filePath string) error
+	FileCreated(ctx context.Context, eventID string, filePath string, result converter.Result) error
+}
+
+type converters interface {
+	ConvertFile(ctx context.Context, source, destination string, options converter.Options) ([]converter.Result, error)
 }
 
 type Service struct {
-	publisher publisher
+	publisher  publisher
+	converters converters
+
+	// outputDir is the directory converted files are written under, in a directory per run and event.
+	outputDir string
+
+	// runID identifies the run of the service among those writing to the output directory.
+	runID string
+}
+
+// WithOutput sets the directory converted files are written under and the ID of the run of the service,
+// which has to differ from those of other runs writing to the same directory.
+func WithOutput(dir, runID string) func(*Service) {
+	return func(s *Service) {
+		s.outputDir = dir
+		s.runID = runID
+	}
 }
 
 // NewService will return a new service with all dependencies.
-func NewService(publisher publisher) Service {
-	return Service{
-		publisher: publisher,
+func NewService(publisher publisher, converters converters, options ...func(*Service)) Service {
+	s := Service{
+		publisher:  publisher,
+		converters: converters,
+		outputDir:  ".",
+		runID:      "local",
+	}
+
+	// Set options.
+	for _, o := range options {
+		o(&s)
 	}
+
+	return s
 }
 
-// Handle will handle all incoming events.
-func (s Service) Handle(ctx context.Context, eventID string, filePath string) error {
+// Handle converts the file of an incoming event into the output format of the options,
+// CSV when none is set, and publishes the converted file with the dialect and encoding detected in it.
+// Each sheet of workbook input converted into a file of its own is published on its own. The files
+// are written to a directory of the event, which is removed when the conversion fails.
+func (s Service) Handle(ctx context.Context, eventID string, filePath string, options converter.Options) error {
 
 	fmt.Println("received event")
 
-	output, err := csvConverter(filePath)
-	if err != nil {
-		fmt.Println(err)
+	if options.Output == "" {
+		options.Output = converter.FormatCSV
 	}
-	err = s.publisher.FileCreated(ctx, "123", output)
-	if err != nil {
-		fmt.Println(err)
-	}
-	return nil
-}
 
-func csvConverter(tsvFileSource string) (string, error) {
-	// Open the TSV file for reading
-	tsvFile, err := os.Open(tsvFileSource)
+	output, err := converter.OutputPath(s.outputDir, s.runID, eventID, options.Output)
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer tsvFile.Close()
 
-	// Create a CSV file for writing
-	csvFile, err := os.Create("file.csv")
+	results, err := s.converters.ConvertFile(ctx, filePath, output, options)
 	if err != nil {
-		return "", err
-	}
-	defer csvFile.Close()
-
-	// Create CSV writer
-	csvWriter := csv.NewWriter(csvFile)
-	defer csvWriter.Flush()
-
-	// Create a TSV reader
-	tsvReader := bufio.NewReader(tsvFile)
-
-	for {
-		// Read a line from the TSV file
-		line, err := tsvReader.ReadString('\n')
-		if err != nil {
+		// Files of an earlier delivery of the event are stale once it fails.
+		if err := os.RemoveAll(filepath.Dir(output)); err != nil {
 			fmt.Println(err)
-			break
 		}
+		return fmt.Errorf("failed to convert %s: %w", filePath, err)
+	}
 
-		// Split the TSV line by tabs
-		fields := strings.Split(strings.TrimSpace(line), "\t")
-
-		// Write the fields to the CSV file
-		err = csvWriter.Write(fields)
-		if err != nil {
-			return "", err
+	for _, result := range results {
+		if err := s.publisher.FileCreated(ctx, eventID, result.Path, result); err != nil {
+			return err
 		}
 	}
-	return "./file.csv", nil
+	return nil
 }
@@ -0,0 +1,124 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-csv-converter/converter"
+	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
+)
+
+// publisherFunc publishes file events by calling itself.
+type publisherFunc func(eventID string, filePath string, result converter.Result) error
+
+func (f publisherFunc) FileCreated(ctx context.Context, eventID string, filePath string, result converter.Result) error {
+	return f(eventID, filePath, result)
+}
+
+// convertersFunc converts files by calling itself.
+type convertersFunc func(source, destination string, options converter.Options) ([]converter.Result, error)
+
+func (f convertersFunc) ConvertFile(ctx context.Context, source, destination string, options converter.Options) ([]converter.Result, error) {
+	return f(source, destination, options)
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name              string
+		eventID           string
+		options           converter.Options
+		err               error
+		expectedDest      string
+		expectedPublished []string
+		expectedErr       error
+	}{
+		{
+			name:              "converted into csv by default",
+			eventID:           "42",
+			expectedDest:      "run-1/42/file.csv",
+			expectedPublished: []string{"run-1/42/file.csv"},
+		},
+		{
+			name:              "every sheet is published",
+			eventID:           "43",
+			options:           converter.Options{Output: converter.FormatParquet, AllSheets: true},
+			expectedDest:      "run-1/43/file.parquet",
+			expectedPublished: []string{"run-1/43/file-a.parquet", "run-1/43/file-b.parquet"},
+		},
+		{
+			name:         "failed conversion removes the directory of the event",
+			eventID:      "44",
+			err:          domain.ErrBadRequest,
+			expectedDest: "run-1/44/file.csv",
+			expectedErr:  domain.ErrBadRequest,
+		},
+		{
+			name:        "no event ID",
+			expectedErr: domain.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+
+			var (
+				dest      string
+				published []string
+			)
+			converters := convertersFunc(func(source, destination string, options converter.Options) ([]converter.Result, error) {
+				dest = destination
+				if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if tt.err != nil {
+					return nil, tt.err
+				}
+
+				if !options.AllSheets {
+					return []converter.Result{{Format: options.Output, Path: destination}}, nil
+				}
+				ext := filepath.Ext(destination)
+				return []converter.Result{
+					{Format: options.Output, Path: destination[:len(destination)-len(ext)] + "-a" + ext, Sheet: "a"},
+					{Format: options.Output, Path: destination[:len(destination)-len(ext)] + "-b" + ext, Sheet: "b"},
+				}, nil
+			})
+			publisher := publisherFunc(func(eventID string, filePath string, result converter.Result) error {
+				if eventID != tt.eventID {
+					t.Errorf("expected event ID to be = %s, got = %s", tt.eventID, eventID)
+				}
+				published = append(published, filePath)
+				return nil
+			})
+
+			s := NewService(publisher, converters, WithOutput(root, "run-1"))
+			err := s.Handle(context.Background(), tt.eventID, "/usr/files/data.tsv", tt.options)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+
+			if tt.expectedDest != "" && dest != filepath.Join(root, tt.expectedDest) {
+				t.Errorf("expected destination to be = %s, got = %s", filepath.Join(root, tt.expectedDest), dest)
+			}
+
+			var expected []string
+			for _, p := range tt.expectedPublished {
+				expected = append(expected, filepath.Join(root, p))
+			}
+			if !reflect.DeepEqual(published, expected) {
+				t.Errorf("expected published files to be = %v, got = %v", expected, published)
+			}
+
+			if tt.err != nil {
+				if _, err := os.Stat(filepath.Dir(dest)); !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("expected directory of the event to be removed, got = %v", err)
+				}
+			}
+		})
+	}
+}
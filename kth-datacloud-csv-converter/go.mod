@@ -4,7 +4,18 @@ go 1.19
 
 require (
 	github.com/rabbitmq/amqp091-go v1.9.0
+	github.com/xitongsys/parquet-go v1.6.2
 	go.uber.org/zap v1.26.0
+	golang.org/x/text v0.13.0
 )
 
-require go.uber.org/multierr v1.10.0 // indirect
+require (
+	github.com/apache/arrow/go/arrow v0.0.0-20200730104253-651201b0f516 // indirect
+	github.com/apache/thrift v0.14.2 // indirect
+	github.com/golang/snappy v0.0.3 // indirect
+	github.com/klauspost/compress v1.13.1 // indirect
+	github.com/pierrec/lz4/v4 v4.1.8 // indirect
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 // indirect
+)
@@ -6,25 +6,35 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/amus-sal/kth-datacloud-csv-converter/converter"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 const (
-	queueName            = "datacloud-tsv"
-	deadLetterExchange   = "datacloud.dlx"
-	webhookReceivedEvent = "tsv.created"
-	requeueDelay         = 60000 // 1 minute.
-	requeueLimit         = 3
-	prefetchCount        = 1
+	queueName          = "datacloud-tsv"
+	deadLetterExchange = "datacloud.dlx"
+	requeueDelay       = 60000 // 1 minute.
+	requeueLimit       = 3
+	prefetchCount      = 1
 )
 
+// Routing keys of the files the unzipper extracted that need converting. CSV is not converted,
+// csv.created events go to the stages after the converter.
+const (
+	tsvCreatedEvent         = "tsv.created"
+	spreadsheetCreatedEvent = "spreadsheet.created"
+	jsonCreatedEvent        = "json.created"
+)
+
+var convertedEvents = []string{tsvCreatedEvent, spreadsheetCreatedEvent, jsonCreatedEvent}
+
 type connector interface {
 	NotifyConnection() <-chan *amqp.Connection
 	Reconnect()
 }
 
 type eventService interface {
-	Handle(ctx context.Context, eventID string, filePath string) error
+	Handle(ctx context.Context, eventID string, filePath string, options converter.Options) error
 }
 
 // Consumer represents a RabbitMQ consumer.
@@ -126,15 +136,17 @@ func (c *Consumer) setup(conn *amqp.Connection) error {
 		return err
 	}
 
-	err = ch.QueueBind(
-		q.Name,               // queue name
-		webhookReceivedEvent, // routing key
-		c.exchange,           // exchange
-		false,
-		nil,
-	)
-	if err != nil {
-		return err
+	for _, routingKey := range convertedEvents {
+		err = ch.QueueBind(
+			q.Name,     // queue name
+			routingKey, // routing key
+			c.exchange, // exchange
+			false,
+			nil,
+		)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Start listening on the messages from this new channel.
@@ -175,9 +187,30 @@ func (c *Consumer) declareDeadLetterExchange(ch *amqp.Channel) error {
 	return nil
 }
 
+// FileEvent is the payload of the consumed and the published file events. Format is the format
+// of the file. The output format, delimiter, sheet selection, column types, schema sample and flattening
+// of arrays are only set on events asking for a conversion, the dialect, original encoding and row counts
+// are only set on events of converted text, the sheet is only set on events of converted sheets and the
+// schema path is only set when a schema was written next to the file.
 type FileEvent struct {
-	EventID  string `json:"event_id"`
-	FilePath string `json:"file_path"`
+	EventID        string                          `json:"event_id"`
+	FilePath       string                          `json:"file_path"`
+	Format         string                          `json:"format,omitempty"`
+	OutputFormat   string                          `json:"output_format,omitempty"`
+	Delimiter      string                          `json:"delimiter,omitempty"`
+	Sheet          string                          `json:"sheet,omitempty"`
+	AllSheets      bool                            `json:"all_sheets,omitempty"`
+	ColumnTypes    map[string]converter.ColumnType `json:"column_types,omitempty"`
+	SchemaSample   int                             `json:"schema_sample_rows,omitempty"`
+	Arrays         string                          `json:"arrays,omitempty"`
+	ArraySeparator string                          `json:"array_separator,omitempty"`
+	SchemaPath     string                          `json:"schema_path,omitempty"`
+	Dialect        *converter.Dialect              `json:"dialect,omitempty"`
+	Encoding       string                          `json:"encoding,omitempty"`
+	RowsRead       int                             `json:"rows_read,omitempty"`
+	RowsWritten    int                             `json:"rows_written,omitempty"`
+	RaggedRows     int                             `json:"ragged_rows,omitempty"`
+	Ragged         []converter.Ragged              `json:"ragged,omitempty"`
 }
 
 func (c *Consumer) csvConverter(msg *amqp.Delivery) {
@@ -193,7 +226,19 @@ func (c *Consumer) csvConverter(msg *amqp.Delivery) {
 		return
 	}
 
-	if err := c.eventService.Handle(context.Background(), payload.EventID, payload.FilePath); err != nil {
+	options := converter.Options{
+		Input:          inputFormat(payload),
+		Output:         converter.Format(payload.OutputFormat),
+		Delimiter:      payload.Delimiter,
+		Sheet:          payload.Sheet,
+		AllSheets:      payload.AllSheets,
+		ColumnTypes:    payload.ColumnTypes,
+		SchemaSample:   payload.SchemaSample,
+		Arrays:         payload.Arrays,
+		ArraySeparator: payload.ArraySeparator,
+	}
+
+	if err := c.eventService.Handle(context.Background(), payload.EventID, payload.FilePath, options); err != nil {
 		fmt.Println(err)
 	}
 
@@ -202,6 +247,16 @@ func (c *Consumer) csvConverter(msg *amqp.Delivery) {
 	}
 }
 
+// inputFormat returns the format of the file of an event. The unzipper sniffs JSON documents and JSON Lines
+// as json alike, so JSON Lines are told apart by the extension of the file.
+func inputFormat(event FileEvent) converter.Format {
+	format := converter.Format(event.Format)
+	if format == converter.FormatJSON && converter.FormatOf(event.FilePath) == converter.FormatNDJSON {
+		return converter.FormatNDJSON
+	}
+	return format
+}
+
 // listen will stall indefinitely and listen for incoming messages,
 // when the connection dies the scope will close, only for the
 // consumer to open a new one.
@@ -210,8 +265,17 @@ func listen(messages <-chan amqp.Delivery, c *Consumer) {
 		// Create a new memory address to solve the loop issue.
 		clone := msg
 		fmt.Println("msg", clone.RoutingKey)
+
+		// Files converted into JSON are published as json.created too, they are not converted back.
+		if clone.AppId == appID {
+			if err := clone.Ack(false); err != nil {
+				fmt.Println(err)
+			}
+			continue
+		}
+
 		switch clone.RoutingKey {
-		case webhookReceivedEvent:
+		case tsvCreatedEvent, spreadsheetCreatedEvent, jsonCreatedEvent:
 			go c.csvConverter(&clone)
 		}
 
@@ -7,10 +7,14 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/amus-sal/kth-datacloud-csv-converter/converter"
 	"github.com/amus-sal/kth-datacloud-csv-converter/domain"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// appID identifies the events published by the converter, so it does not consume its own.
+const appID = "kth-datacloud-csv-converter"
+
 type logger interface {
 	Errorw(msg string, keysAndValues ...interface{})
 }
@@ -100,11 +104,21 @@ func (p *Publisher) Close() {
 	})
 }
 
-// PurchaseSucceeded will publish the event when a purchase has succeeded.
-func (p *Publisher) FileCreated(ctx context.Context, eventID string, filePath string) error {
+// FileCreated will publish the event when a file has been converted, the routing
+// key is taken from the format so each output format reaches its own consumers.
+func (p *Publisher) FileCreated(ctx context.Context, eventID string, filePath string, result converter.Result) error {
 	payload := FileEvent{
-		EventID:  eventID,
-		FilePath: filePath,
+		EventID:     eventID,
+		FilePath:    filePath,
+		Format:      string(result.Format),
+		Sheet:       result.Sheet,
+		Dialect:     result.Dialect,
+		Encoding:    result.Encoding,
+		RowsRead:    result.RowsRead,
+		RowsWritten: result.RowsWritten,
+		RaggedRows:  result.RaggedRows,
+		Ragged:      result.Ragged,
+		SchemaPath:  result.SchemaPath,
 	}
 
 	fmt.Println("get file")
@@ -113,7 +127,7 @@ func (p *Publisher) FileCreated(ctx context.Context, eventID string, filePath st
 		return fmt.Errorf("failed to marshal payload for event ID = %s: %w", eventID, domain.ErrBadRequest)
 	}
 
-	return p.publish(ctx, "csv.created", bytes)
+	return p.publish(ctx, string(result.Format)+".created", bytes)
 }
 
 // Publish will publish the message on the given exchange.
@@ -131,6 +145,7 @@ func (p *Publisher) publish(ctx context.Context, routingKey string, payload []by
 		false, // immediate
 		amqp.Publishing{
 			ContentType: "application/json",
+			AppId:       appID,
 			Body:        payload,
 		})
 }
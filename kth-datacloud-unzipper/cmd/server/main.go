@@ -7,14 +7,23 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/amus-sal/kth-datacloud-unzipper/commandhandler"
+	commandhandler "github.com/amus-sal/kth-datacloud-unzipper/command-handler"
 	"github.com/amus-sal/kth-datacloud-unzipper/connection"
+	"github.com/amus-sal/kth-datacloud-unzipper/downloader"
+	"github.com/amus-sal/kth-datacloud-unzipper/extractor"
 	"github.com/amus-sal/kth-datacloud-unzipper/httpencoder"
 	"github.com/amus-sal/kth-datacloud-unzipper/httpserver"
 	"github.com/amus-sal/kth-datacloud-unzipper/httpserver/unzipper"
+	"github.com/amus-sal/kth-datacloud-unzipper/ingest"
+	"github.com/amus-sal/kth-datacloud-unzipper/job"
+	"github.com/amus-sal/kth-datacloud-unzipper/secrets"
+	"github.com/amus-sal/kth-datacloud-unzipper/upload"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
@@ -32,14 +41,50 @@ type rabbitSecret struct {
 
 func main() {
 
+	// Limits protecting the shared volume against archive bombs.
+	limits := extractor.Limits{
+		MaxBytes:   envInt("EXTRACT_MAX_BYTES", extractor.DefaultLimits.MaxBytes),
+		MaxEntries: int(envInt("EXTRACT_MAX_ENTRIES", int64(extractor.DefaultLimits.MaxEntries))),
+		MaxRatio:   envInt("EXTRACT_MAX_RATIO", extractor.DefaultLimits.MaxRatio),
+		MaxDepth:   int(envInt("EXTRACT_MAX_DEPTH", int64(extractor.DefaultLimits.MaxDepth))),
+	}
+
+	// Encoding of zip entry names that are not marked as UTF-8, it is detected per name when not set.
+	nameEncoding := envString("ZIP_NAME_ENCODING", "")
+	if _, ok := extractor.NameEncodings[nameEncoding]; nameEncoding != "" && !ok {
+		log.Fatalf("unknown zip name encoding %q", nameEncoding)
+	}
+
+	// Extractor that unpacks the uploaded archives, nested archives are only
+	// extracted when a maximum nesting depth is configured.
+	archiveExtractor := extractor.NewExtractor(
+		limits,
+		extractor.WithNesting(int(envInt("EXTRACT_MAX_NESTING", 0))),
+		extractor.WithExcludes(envList("EXTRACT_DEFAULT_EXCLUDES", extractor.DefaultExcludes)),
+		extractor.WithNameEncoding(nameEncoding),
+	)
+
+	// Passwords of encrypted archives, looked up by the name of their dataset.
+	passwords := secrets.NewPasswords(envString("ARCHIVE_SECRETS", "./archive-secrets.json"))
+
+	// CLI mode for workflow steps, a failed extraction exits with a non-zero code.
 	if len(os.Args) > 1 {
 		file := os.Args[1]
-		commandhandler.Handle(file)
-		os.exit(0)
+		options := extractor.Options{
+			Password: envString("ARCHIVE_PASSWORD", ""),
+			Include:  envList("EXTRACT_INCLUDE", nil),
+			Exclude:  envList("EXTRACT_EXCLUDE", nil),
+		}
+		if err := commandhandler.Handle(file, envString("ARCHIVE_DATASET", ""), options, passwords, archiveExtractor); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
 	}
 
 	var (
-		httpAddress = envString("HTTP_ADDRESS", ":8085")
+		httpAddress  = envString("HTTP_ADDRESS", ":8085")
+		sharedVolume = envString("SHARED_VOLUME", "/usr/file")
 	)
 
 	const serviceName = "unzipper-api"
@@ -103,8 +148,31 @@ func main() {
 	// Encoder to encode all http responses and errors.
 	encoder := httpencoder.NewEncoder()
 
+	// Job store that keeps track of every ingested archive on the shared volume.
+	jobs, err := job.NewFileStore(filepath.Join(sharedVolume, ".jobs"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Upload store that keeps resumable uploads on the shared volume, so they survive restarts.
+	uploads, err := upload.NewStore(filepath.Join(sharedVolume, ".uploads"), envInt("UPLOAD_MAX_BYTES", extractor.DefaultLimits.MaxBytes))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Downloader that fetches archives ingested by URL, local files have to be on the shared volume.
+	archiveDownloader := downloader.NewDownloader(
+		sharedVolume,
+		downloader.WithMaxBytes(envInt("DOWNLOAD_MAX_BYTES", extractor.DefaultLimits.MaxBytes)),
+		downloader.WithTimeout(envDuration("DOWNLOAD_TIMEOUT", time.Hour)),
+		downloader.WithRetries(int(envInt("DOWNLOAD_RETRIES", 3))),
+	)
+
+	// Ingest service extracts the archives and publishes their files in the background.
+	ingestService := ingest.NewService(publisher, archiveExtractor, archiveDownloader, passwords, jobs, uploads, sharedVolume)
+
 	// Handler that will handle all HTTP reqeusts on the / routes.
-	unzipper := unzipper.NewHandler(encoder, publisher)
+	unzipper := unzipper.NewHandler(encoder, ingestService)
 
 	// Channel to receive errors on from different go routines, such as the http server.
 	errorChannel := make(chan error)
@@ -134,3 +202,37 @@ func envString(key string, fallback string) string {
 	}
 	return fallback
 }
+
+func envInt(key string, fallback int64) int64 {
+	if value, ok := syscall.Getenv(key); ok {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	}
+	return fallback
+}
+
+// envList returns the comma separated values of key, an empty value gives an empty list.
+func envList(key string, fallback []string) []string {
+	value, ok := syscall.Getenv(key)
+	if !ok {
+		return fallback
+	}
+
+	list := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if value, ok := syscall.Getenv(key); ok {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
@@ -1,94 +1,156 @@
 package commandhandler
 
 import (
-	"archive/zip"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
 	"os"
 	"path/filepath"
-	"strings"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"github.com/amus-sal/kth-datacloud-unzipper/extractor"
 )
 
-func Handle(path string) {
+const (
+	// destination is the shared volume, every run extracts into a directory of its own on it.
+	destination = "/usr/files"
 
-	dest, err := unzip(path, "/usr/files")
-	if err != nil {
-		fmt.Println(err)
-	}
-	f, err := os.Create("/tmp/output.txt")
+	// outputPath is read by Argo as the output parameter of the step,
+	// it holds the paths of the extracted files as a JSON array.
+	outputPath = "/tmp/output.txt"
 
-	if err != nil {
-		log.Fatal(err)
-	}
+	// errorPath holds the error of a failed run as JSON, so the workflow can tell why the step failed.
+	errorPath = "/tmp/error.json"
+)
+
+type archiveExtractor interface {
+	Extract(source, destination string, options extractor.Options) (extractor.Result, error)
+}
 
-	defer f.Close()
+type passwords interface {
+	Password(dataset, password string) (string, error)
+}
 
-	_, err = f.WriteString(dest)
+// runError is the machine readable error of a failed run.
+type runError struct {
+	Archive string `json:"archive"`
 
+	// Code is one of bad_request, not_found, too_large, wrong_password or internal.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Handle extracts every entry of the archive at path into a new directory on the shared destination, writes
+// its manifest and writes the paths of the extracted files to the output file. The directory is removed when
+// the run fails, files of earlier runs are never touched. The password of an encrypted archive is
+// either set in options or looked up by dataset. When it fails, the error is written to the error file
+// and returned, so the step can exit with a non-zero code.
+func Handle(path string, dataset string, options extractor.Options, passwords passwords, extractor archiveExtractor) error {
+	// Outputs of an earlier run in the same container must not be mistaken for this one.
+	for _, p := range []string{outputPath, errorPath} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	files, err := extract(path, dataset, options, passwords, extractor)
 	if err != nil {
-		log.Fatal(err)
+		if err := writeError(path, err); err != nil {
+			fmt.Println(err)
+		}
+		return err
 	}
+
+	return writeJSON(outputPath, files)
 }
 
-func unzip(source, destination string) (string, error) {
-	// 1. Open the zip file
-	reader, err := zip.OpenReader(source)
+// extract extracts the archive into a new directory of the run and writes its manifest, it returns the paths
+// of the extracted files. The directory is removed when extraction fails.
+func extract(path string, dataset string, options extractor.Options, passwords passwords, extractor archiveExtractor) ([]string, error) {
+	password, err := passwords.Password(dataset, options.Password)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer reader.Close()
+	options.Password = password
 
-	// 2. Get the absolute destination path
-	destination, err = filepath.Abs(destination)
+	dir, err := runDir(path)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to create directory of the run: %v: %w", err, domain.ErrInternal)
 	}
 
-	// 3. Iterate over zip files inside the archive and unzip each of them
-	err = unzipFile(reader.File[0], destination)
+	result, err := extractor.Extract(path, dir, options)
+	if err == nil {
+		if err = writeManifest(dir, path, result); err != nil {
+			err = fmt.Errorf("failed to write manifest: %v: %w", err, domain.ErrInternal)
+		}
+	}
 	if err != nil {
-		return "", err
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Println(err)
+		}
+		return nil, err
 	}
 
-	return destination, nil
+	files := []string{}
+	for _, file := range result.Files {
+		files = append(files, file.Path)
+	}
+	return files, nil
 }
 
-func unzipFile(f *zip.File, destination string) (string, error) {
-	// 4. Check if file paths are not vulnerable to Zip Slip
-	filePath := filepath.Join(destination, f.Name)
-	if !strings.HasPrefix(filePath, filepath.Clean(destination)+string(os.PathSeparator)) {
-		return filePath, fmt.Errorf("invalid file path: %s", filePath)
+// runDir creates a new directory on the destination for the run extracting the archive at path, named after it.
+func runDir(path string) (string, error) {
+	dir, err := os.MkdirTemp(destination, filepath.Base(path)+"-")
+	if err != nil {
+		return "", err
 	}
 
-	// 5. Create directory tree
-	if f.FileInfo().IsDir() {
-		if err := os.MkdirAll(filePath, os.ModePerm); err != nil {
-			return filePath, err
-		}
-		return filePath, nil
+	// The next steps of the workflow may run as other users.
+	if err := os.Chmod(dir, 0755); err != nil {
+		os.Remove(dir)
+		return "", err
 	}
+	return dir, nil
+}
+
+// writeManifest writes the manifest of the archive at path next to the files extracted into dir.
+func writeManifest(dir, path string, result extractor.Result) error {
+	name := filepath.Base(path)
+	return extractor.NewManifest(name, result).Write(filepath.Join(dir, name+"."+extractor.ManifestName))
+}
 
-	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
-		return filePath, err
+// writeError writes err to the error file. An empty output is written as well,
+// so steps reading the output parameter do not fail on a missing file.
+func writeError(path string, err error) error {
+	code := "internal"
+	switch {
+	case errors.Is(err, domain.ErrBadRequest):
+		code = "bad_request"
+	case errors.Is(err, domain.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		code = "not_found"
+	case errors.Is(err, domain.ErrTooLarge):
+		code = "too_large"
+	case errors.Is(err, domain.ErrWrongPassword):
+		code = "wrong_password"
 	}
 
-	// 6. Create a destination file for unzipped content
-	destinationFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-	if err != nil {
-		return filePath, err
+	if err := writeJSON(outputPath, []string{}); err != nil {
+		return err
 	}
-	defer destinationFile.Close()
 
-	// 7. Unzip the content of a file and copy it to the destination file
-	zippedFile, err := f.Open()
+	return writeJSON(errorPath, runError{
+		Archive: path,
+		Code:    code,
+		Message: err.Error(),
+	})
+}
+
+// writeJSON writes v as JSON to path.
+func writeJSON(path string, v interface{}) error {
+	b, err := json.Marshal(v)
 	if err != nil {
-		return filePath, err
+		return err
 	}
-	defer zippedFile.Close()
 
-	if _, err := io.Copy(destinationFile, zippedFile); err != nil {
-		return filePath, err
-	}
-	return filePath, nil
+	return os.WriteFile(path, b, 0644)
 }
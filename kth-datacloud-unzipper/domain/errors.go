@@ -11,6 +11,18 @@ const (
 	// ErrBadRequest is returned when the request was invalid.
 	ErrBadRequest = Error("invalid request data")
 
+	// ErrNotFound is returned when the requested resource does not exist.
+	ErrNotFound = Error("not found")
+
+	// ErrTooLarge is returned when the request exceeds a configured size limit.
+	ErrTooLarge = Error("request too large")
+
+	// ErrConflict is returned when the request conflicts with the current state of the resource.
+	ErrConflict = Error("conflict")
+
+	// ErrWrongPassword is returned when an encrypted archive was sent without its correct password.
+	ErrWrongPassword = Error("wrong archive password")
+
 	// ErrInternal is returned when the error is unspecified.
 	ErrInternal = Error("internal error")
 )
@@ -0,0 +1,304 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+)
+
+// Downloader fetches archives from http(s) URLs or from file URLs on the shared volume.
+type Downloader struct {
+	client *http.Client
+
+	// root is the directory file URLs have to point into.
+	root string
+
+	// maxBytes is the maximum size of a downloaded archive, zero means unlimited.
+	maxBytes int64
+
+	// timeout is the maximum duration of a download including all retries.
+	timeout time.Duration
+
+	// retries is the number of times an interrupted download is resumed.
+	retries int
+
+	// retryDelay is the delay before the first retry, it grows with every attempt.
+	retryDelay time.Duration
+}
+
+// WithMaxBytes limits the size of downloaded archives.
+func WithMaxBytes(maxBytes int64) func(*Downloader) {
+	return func(d *Downloader) {
+		d.maxBytes = maxBytes
+	}
+}
+
+// WithTimeout limits the total duration of a download.
+func WithTimeout(timeout time.Duration) func(*Downloader) {
+	return func(d *Downloader) {
+		d.timeout = timeout
+	}
+}
+
+// WithRetries sets the number of times an interrupted download is resumed.
+func WithRetries(retries int) func(*Downloader) {
+	return func(d *Downloader) {
+		d.retries = retries
+	}
+}
+
+// NewDownloader returns a downloader that only reads local files inside root.
+func NewDownloader(root string, options ...func(*Downloader)) Downloader {
+	d := Downloader{
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: 30 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+			},
+		},
+		root:       root,
+		timeout:    time.Hour,
+		retries:    3,
+		retryDelay: 2 * time.Second,
+	}
+
+	// Set options.
+	for _, o := range options {
+		o(&d)
+	}
+
+	return d
+}
+
+// Download stores the archive at source in the file destination. When checksum is
+// set, the SHA-256 of the downloaded archive has to match the hex encoded checksum.
+func (d Downloader) Download(ctx context.Context, source, destination, checksum string) error {
+	u, err := url.Parse(source)
+	if err != nil {
+		return fmt.Errorf("invalid source URL %s: %v: %w", source, err, domain.ErrBadRequest)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	switch u.Scheme {
+	case "http", "https":
+		err = d.fetch(ctx, u.String(), destination)
+	case "file":
+		err = d.copyLocal(u.Path, destination)
+	default:
+		err = fmt.Errorf("unsupported source URL scheme %q: %w", u.Scheme, domain.ErrBadRequest)
+	}
+	if err != nil {
+		return err
+	}
+
+	if checksum != "" {
+		return verify(destination, checksum)
+	}
+	return nil
+}
+
+// fetch downloads url to destination, resuming with range requests when the transfer is interrupted.
+func (d Downloader) fetch(ctx context.Context, url, destination string) error {
+	f, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var offset int64
+	for attempt := 0; ; attempt++ {
+		offset, err = d.fetchFrom(ctx, url, f, offset)
+		if err == nil {
+			return f.Close()
+		}
+
+		// Client errors, limits and cancellation do not get better by trying again.
+		if attempt >= d.retries || ctx.Err() != nil ||
+			errors.Is(err, domain.ErrBadRequest) || errors.Is(err, domain.ErrTooLarge) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("download of %s timed out: %v: %w", url, err, domain.ErrBadRequest)
+		case <-time.After(d.retryDelay * time.Duration(attempt+1)):
+		}
+	}
+}
+
+// fetchFrom requests url starting at offset and appends the response to f.
+// It returns the number of bytes in f after the attempt, also when it fails.
+func (d Downloader) fetchFrom(ctx context.Context, url string, f *os.File, offset int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return offset, fmt.Errorf("invalid source URL %s: %v: %w", url, err, domain.ErrBadRequest)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return offset, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		// The server sends the whole archive, either the first attempt or it does not support ranges.
+		if offset > 0 {
+			if err := f.Truncate(0); err != nil {
+				return 0, err
+			}
+			offset = 0
+		}
+	case resp.StatusCode == http.StatusPartialContent:
+		if start := rangeStart(resp.Header.Get("Content-Range")); start != offset {
+			return offset, fmt.Errorf("unexpected content range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// Everything was already received before the connection dropped.
+		return offset, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return offset, fmt.Errorf("download of %s failed with status %d", url, resp.StatusCode)
+	default:
+		return offset, fmt.Errorf("download of %s failed with status %d: %w", url, resp.StatusCode, domain.ErrBadRequest)
+	}
+
+	if d.maxBytes > 0 && resp.ContentLength > 0 && offset+resp.ContentLength > d.maxBytes {
+		return offset, fmt.Errorf("archive is larger than %d bytes: %w", d.maxBytes, domain.ErrTooLarge)
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	n, err := d.copy(f, resp.Body, offset)
+	return offset + n, err
+}
+
+// copyLocal copies a file from the shared volume, it is copied rather than used
+// in place since the archive is removed once it has been extracted.
+func (d Downloader) copyLocal(path, destination string) error {
+	path, err := d.localPath(path)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("file %s is not a regular file: %w", path, domain.ErrBadRequest)
+	}
+
+	dst, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := d.copy(dst, src, 0); err != nil {
+		return err
+	}
+	return dst.Close()
+}
+
+// localPath returns path with its symbolic links resolved, so it cannot point out of the shared volume through
+// a link on it. Hidden directories at the root of the volume hold the state of the service, such as its jobs,
+// their files are not archives to ingest.
+func (d Downloader) localPath(path string) (string, error) {
+	root, err := filepath.EvalSymlinks(d.root)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("file %s does not exist: %w", path, domain.ErrBadRequest)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("file %s is not on the shared volume: %w", path, domain.ErrBadRequest)
+	}
+	if strings.HasPrefix(rel, ".") {
+		return "", fmt.Errorf("file %s is in a directory of the service: %w", path, domain.ErrBadRequest)
+	}
+	return resolved, nil
+}
+
+// copy copies r into w and fails when the total, including the offset already written, exceeds the maximum size.
+func (d Downloader) copy(w io.Writer, r io.Reader, offset int64) (int64, error) {
+	if d.maxBytes <= 0 {
+		return io.Copy(w, r)
+	}
+
+	n, err := io.Copy(w, io.LimitReader(r, d.maxBytes-offset+1))
+	if err != nil {
+		return n, err
+	}
+	if offset+n > d.maxBytes {
+		return n, fmt.Errorf("archive is larger than %d bytes: %w", d.maxBytes, domain.ErrTooLarge)
+	}
+	return n, nil
+}
+
+// verify compares the SHA-256 of the file at path with the hex encoded checksum.
+func verify(path, checksum string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, checksum) {
+		return fmt.Errorf("checksum mismatch, expected %s got %s: %w", checksum, sum, domain.ErrBadRequest)
+	}
+	return nil
+}
+
+// rangeStart returns the first byte of a "bytes start-end/size" content range, or -1 when invalid.
+func rangeStart(contentRange string) int64 {
+	spec := strings.TrimPrefix(contentRange, "bytes ")
+	i := strings.IndexByte(spec, '-')
+	if i <= 0 {
+		return -1
+	}
+
+	start, err := strconv.ParseInt(spec[:i], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
@@ -0,0 +1,167 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+)
+
+var archive = bytes.Repeat([]byte("kth-datacloud "), 1000)
+
+// flakyServer serves the archive with range support, but drops the connection
+// halfway through the first response.
+func flakyServer(t *testing.T) *httptest.Server {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+			w.Write(archive[:len(archive)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+
+		http.ServeContent(w, r, "archive.zip", time.Time{}, bytes.NewReader(archive))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownload(t *testing.T) {
+	sum := sha256.Sum256(archive)
+	root := t.TempDir()
+
+	local := filepath.Join(root, "datasets", "archive.zip")
+	if err := os.MkdirAll(filepath.Dir(local), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(local, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Links on the shared volume are resolved before the file is checked to be on it.
+	outside := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(outside, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "datasets", "outside.zip")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(local, filepath.Join(root, "datasets", "inside.zip")); err != nil {
+		t.Fatal(err)
+	}
+
+	// State of the service is kept in hidden directories of the shared volume.
+	state := filepath.Join(root, ".jobs", "archive.zip")
+	if err := os.MkdirAll(filepath.Dir(state), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(state, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		source      func(t *testing.T) string
+		checksum    string
+		maxBytes    int64
+		expectedErr error
+	}{
+		{
+			name:     "resumes an interrupted download",
+			source:   func(t *testing.T) string { return flakyServer(t).URL + "/archive.zip" },
+			checksum: hex.EncodeToString(sum[:]),
+		},
+		{
+			name:        "checksum mismatch",
+			source:      func(t *testing.T) string { return flakyServer(t).URL + "/archive.zip" },
+			checksum:    hex.EncodeToString(make([]byte, sha256.Size)),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "too large",
+			source:      func(t *testing.T) string { return flakyServer(t).URL + "/archive.zip" },
+			maxBytes:    int64(len(archive) / 4),
+			expectedErr: domain.ErrTooLarge,
+		},
+		{
+			name: "not found",
+			source: func(t *testing.T) string {
+				server := httptest.NewServer(http.NotFoundHandler())
+				t.Cleanup(server.Close)
+				return server.URL
+			},
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:     "file on the shared volume",
+			source:   func(t *testing.T) string { return "file://" + local },
+			checksum: hex.EncodeToString(sum[:]),
+		},
+		{
+			name:        "file outside the shared volume",
+			source:      func(t *testing.T) string { return "file:///etc/passwd" },
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:     "link to a file on the shared volume",
+			source:   func(t *testing.T) string { return "file://" + filepath.Join(root, "datasets", "inside.zip") },
+			checksum: hex.EncodeToString(sum[:]),
+		},
+		{
+			name:        "link out of the shared volume",
+			source:      func(t *testing.T) string { return "file://" + filepath.Join(root, "datasets", "outside.zip") },
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "file of the service",
+			source:      func(t *testing.T) string { return "file://" + state },
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "directory on the shared volume",
+			source:      func(t *testing.T) string { return "file://" + filepath.Join(root, "datasets") },
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "file that does not exist",
+			source:      func(t *testing.T) string { return "file://" + filepath.Join(root, "datasets", "missing.zip") },
+			expectedErr: domain.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDownloader(root, WithMaxBytes(tt.maxBytes))
+			d.retryDelay = time.Millisecond
+
+			destination := filepath.Join(t.TempDir(), "archive.zip")
+			err := d.Download(context.TODO(), tt.source(t), destination, tt.checksum)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			b, err := os.ReadFile(destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, archive) {
+				t.Errorf("expected %d bytes of archive, got %d bytes", len(archive), len(b))
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package extractor
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// flagEncrypted marks an encrypted zip entry.
+	flagEncrypted = 0x1
+
+	// flagDataDescriptor marks a zip entry whose CRC is stored after its content.
+	flagDataDescriptor = 0x8
+
+	// methodAES is the compression method of WinZip AES encrypted entries,
+	// the actual compression method is stored in the AES extra field.
+	methodAES = 99
+
+	// aesExtraID is the ID of the WinZip AES extra field.
+	aesExtraID = 0x9901
+
+	// zipCryptoHeaderSize is the size of the encryption header in front of ZipCrypto encrypted content.
+	zipCryptoHeaderSize = 12
+
+	// aesVerifierSize and aesMACSize are the sizes of the password verifier and
+	// authentication code around WinZip AES encrypted content.
+	aesVerifierSize = 2
+	aesMACSize      = 10
+)
+
+// openZipFile opens the content of the zip entry, decrypting it with password when it is
+// encrypted with either ZipCrypto or WinZip AES.
+func openZipFile(f *zip.File, password string) (io.ReadCloser, error) {
+	if f.Flags&flagEncrypted == 0 {
+		return f.Open()
+	}
+
+	if password == "" {
+		return nil, fmt.Errorf("entry %s is encrypted, but no password was given: %w", f.Name, domain.ErrWrongPassword)
+	}
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		r        io.Reader
+		method   = f.Method
+		checkCRC = true
+	)
+
+	if f.Method == methodAES {
+		extra, err := parseAESExtra(f.Extra)
+		if err != nil {
+			return nil, fmt.Errorf("entry %s: %v: %w", f.Name, err, domain.ErrBadRequest)
+		}
+
+		r, err = newAESReader(raw, int64(f.CompressedSize64), password, extra.strength)
+		if err != nil {
+			return nil, fmt.Errorf("entry %s: %w", f.Name, err)
+		}
+
+		// AE-2 leaves the CRC empty, the authentication code protects the content instead.
+		method = extra.method
+		checkCRC = extra.version == 1
+	} else {
+		// The last byte of the header is checked against the CRC, or against the modification
+		// time when the CRC is only known after the content was written.
+		check := byte(f.CRC32 >> 24)
+		if f.Flags&flagDataDescriptor != 0 {
+			check = byte(f.ModifiedTime >> 8)
+		}
+
+		r, err = newZipCryptoReader(raw, password, check)
+		if err != nil {
+			return nil, fmt.Errorf("entry %s: %w", f.Name, err)
+		}
+	}
+
+	var rc io.ReadCloser
+	switch method {
+	case zip.Store:
+		rc = io.NopCloser(r)
+	case zip.Deflate:
+		rc = flate.NewReader(r)
+	default:
+		return nil, fmt.Errorf("entry %s uses unsupported compression method %d: %w", f.Name, method, domain.ErrBadRequest)
+	}
+
+	if !checkCRC {
+		return rc, nil
+	}
+	return &crcReader{ReadCloser: rc, name: f.Name, hash: crc32.NewIEEE(), expected: f.CRC32}, nil
+}
+
+// zipCryptoReader decrypts the traditional PKWARE encryption.
+type zipCryptoReader struct {
+	r    io.Reader
+	keys [3]uint32
+}
+
+// newZipCryptoReader initializes the keys from password and verifies it against the check byte of the encryption header.
+func newZipCryptoReader(r io.Reader, password string, check byte) (*zipCryptoReader, error) {
+	z := &zipCryptoReader{
+		r:    r,
+		keys: [3]uint32{0x12345678, 0x23456789, 0x34567890},
+	}
+	for i := 0; i < len(password); i++ {
+		z.update(password[i])
+	}
+
+	header := make([]byte, zipCryptoHeaderSize)
+	if _, err := io.ReadFull(z, header); err != nil {
+		return nil, fmt.Errorf("failed to read encryption header: %v: %w", err, domain.ErrBadRequest)
+	}
+	if header[zipCryptoHeaderSize-1] != check {
+		return nil, fmt.Errorf("wrong password: %w", domain.ErrWrongPassword)
+	}
+
+	return z, nil
+}
+
+func (z *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := z.r.Read(p)
+	for i := 0; i < n; i++ {
+		t := z.keys[2] | 2
+		p[i] ^= byte((t * (t ^ 1)) >> 8)
+		z.update(p[i])
+	}
+	return n, err
+}
+
+func (z *zipCryptoReader) update(b byte) {
+	z.keys[0] = crc32.IEEETable[byte(z.keys[0])^b] ^ (z.keys[0] >> 8)
+	z.keys[1] = (z.keys[1]+(z.keys[0]&0xff))*134775813 + 1
+	z.keys[2] = crc32.IEEETable[byte(z.keys[2])^byte(z.keys[1]>>24)] ^ (z.keys[2] >> 8)
+}
+
+// aesExtra is the content of the WinZip AES extra field.
+type aesExtra struct {
+	version  uint16
+	strength byte
+	method   uint16
+}
+
+// parseAESExtra finds the WinZip AES field in the extra fields of an entry.
+func parseAESExtra(extra []byte) (aesExtra, error) {
+	field, ok := extraField(extra, aesExtraID)
+	if !ok || len(field) < 7 {
+		return aesExtra{}, errors.New("missing AES extra field")
+	}
+
+	return aesExtra{
+		version:  binary.LittleEndian.Uint16(field),
+		strength: field[4],
+		method:   binary.LittleEndian.Uint16(field[5:]),
+	}, nil
+}
+
+// aesReader decrypts WinZip AES content, which is AES in counter mode with a little endian counter,
+// and verifies the authentication code that follows it once all content was read.
+type aesReader struct {
+	r      *io.LimitedReader
+	mac    io.Reader
+	block  cipher.Block
+	hmac   hash.Hash
+	nonce  uint64
+	stream [aes.BlockSize]byte
+	pos    int
+}
+
+// newAESReader derives the keys from password and the salt in front of the content
+// and verifies the password against the password verifier.
+func newAESReader(r io.Reader, size int64, password string, strength byte) (*aesReader, error) {
+	var keySize int
+	switch strength {
+	case 1, 2, 3:
+		keySize = 8 + 8*int(strength)
+	default:
+		return nil, fmt.Errorf("unsupported AES strength %d: %w", strength, domain.ErrBadRequest)
+	}
+
+	saltSize := keySize / 2
+	contentSize := size - int64(saltSize+aesVerifierSize+aesMACSize)
+	if contentSize < 0 {
+		return nil, fmt.Errorf("encrypted content is truncated: %w", domain.ErrBadRequest)
+	}
+
+	header := make([]byte, saltSize+aesVerifierSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read encryption header: %v: %w", err, domain.ErrBadRequest)
+	}
+
+	key := pbkdf2.Key([]byte(password), header[:saltSize], 1000, 2*keySize+aesVerifierSize, sha1.New)
+	if subtle.ConstantTimeCompare(key[2*keySize:], header[saltSize:]) != 1 {
+		return nil, fmt.Errorf("wrong password: %w", domain.ErrWrongPassword)
+	}
+
+	block, err := aes.NewCipher(key[:keySize])
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesReader{
+		r:     &io.LimitedReader{R: r, N: contentSize},
+		mac:   r,
+		block: block,
+		hmac:  hmac.New(sha1.New, key[keySize:2*keySize]),
+		pos:   aes.BlockSize,
+	}, nil
+}
+
+func (a *aesReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	a.hmac.Write(p[:n])
+
+	for i := 0; i < n; i++ {
+		if a.pos == aes.BlockSize {
+			a.nonce++
+			var counter [aes.BlockSize]byte
+			binary.LittleEndian.PutUint64(counter[:], a.nonce)
+			a.block.Encrypt(a.stream[:], counter[:])
+			a.pos = 0
+		}
+		p[i] ^= a.stream[a.pos]
+		a.pos++
+	}
+
+	// The authentication code is checked as soon as the content was consumed, since
+	// the decompressor does not necessarily read until the end of the content.
+	if a.r.N == 0 && a.mac != nil {
+		mac := make([]byte, aesMACSize)
+		if _, err := io.ReadFull(a.mac, mac); err != nil {
+			return n, fmt.Errorf("failed to read authentication code: %v: %w", err, domain.ErrBadRequest)
+		}
+		if !hmac.Equal(mac, a.hmac.Sum(nil)[:aesMACSize]) {
+			return n, fmt.Errorf("authentication failed, the content was modified: %w", domain.ErrBadRequest)
+		}
+		a.mac = nil
+	}
+	return n, err
+}
+
+// crcReader verifies the CRC of decrypted content once all of it was read,
+// the zip package only does so for the entries it decompresses itself.
+type crcReader struct {
+	io.ReadCloser
+	name     string
+	hash     hash.Hash32
+	expected uint32
+}
+
+func (c *crcReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.hash.Write(p[:n])
+
+	if err == io.EOF && c.hash.Sum32() != c.expected {
+		return n, fmt.Errorf("entry %s failed its checksum: %w", c.name, domain.ErrBadRequest)
+	}
+	return n, err
+}
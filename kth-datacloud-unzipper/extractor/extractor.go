@@ -0,0 +1,518 @@
+package extractor
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"github.com/amus-sal/kth-datacloud-unzipper/sniffer"
+	"golang.org/x/text/encoding"
+)
+
+// Extractor unpacks archives into a destination directory.
+type Extractor struct {
+	limits Limits
+
+	// nesting is the number of levels of archives inside archives that are extracted as well.
+	nesting int
+
+	// excludes are the glob patterns of entries that are never extracted.
+	excludes []string
+
+	// nameEncoding decodes zip entry names that are not marked as UTF-8, nil detects the encoding.
+	nameEncoding encoding.Encoding
+}
+
+// WithNesting makes the extractor descend into archives found inside the archive, up to depth levels.
+// The contents of a nested archive are extracted into a directory named after the archive itself,
+// so the original nesting is kept as a path prefix.
+func WithNesting(depth int) func(*Extractor) {
+	return func(e *Extractor) {
+		e.nesting = depth
+	}
+}
+
+// WithExcludes replaces the default excludes with the given glob patterns,
+// the excludes of a single extraction are added to them.
+func WithExcludes(patterns []string) func(*Extractor) {
+	return func(e *Extractor) {
+		e.excludes = patterns
+	}
+}
+
+// WithNameEncoding decodes zip entry names that are not marked as UTF-8 with the named encoding of
+// NameEncodings, rather than detecting whether they are CP437 or Shift-JIS. An empty name detects it.
+func WithNameEncoding(name string) func(*Extractor) {
+	return func(e *Extractor) {
+		e.nameEncoding = NameEncodings[name]
+	}
+}
+
+// NewExtractor returns a new extractor enforcing the given limits.
+func NewExtractor(limits Limits, options ...func(*Extractor)) Extractor {
+	e := Extractor{
+		limits:   limits,
+		excludes: DefaultExcludes,
+	}
+
+	// Set options.
+	for _, o := range options {
+		o(&e)
+	}
+
+	return e
+}
+
+// Options are the settings of a single extraction.
+type Options struct {
+	// Password decrypts ZipCrypto and WinZip AES encrypted zip entries, nested archives included.
+	Password string
+
+	// Include are glob patterns of the entries to extract, all entries are extracted when empty.
+	Include []string
+
+	// Exclude are glob patterns of entries to skip in addition to the default excludes,
+	// they take precedence over Include.
+	Exclude []string
+}
+
+// Result lists the outcome of an extraction.
+type Result struct {
+	// Files are the regular files that were extracted.
+	Files []File
+
+	// Skipped are the names of the entries that were filtered out by the include and exclude patterns.
+	Skipped []string
+}
+
+// Extract unpacks the archive at source into destination and returns
+// all regular files that were extracted and the entries that were skipped.
+// The format of the archive is detected from its content, not from its file extension.
+// When extraction fails everything written so far is removed again.
+func (e Extractor) Extract(source, destination string, options Options) (Result, error) {
+	return e.run(destination, options, func(x *extraction) error {
+		return x.extract(source, filepath.Base(source), x.root, 0)
+	})
+}
+
+// ExtractStream unpacks the archive read from r into destination while it is read, so the archive
+// itself is never stored. Only streamable formats are supported, zip archives are rejected.
+// name is the name of the archive, single compressed files are named after it.
+func (e Extractor) ExtractStream(r io.Reader, name, destination string, options Options) (Result, error) {
+	return e.run(destination, options, func(x *extraction) error {
+		if err := x.unpackReader(r, name, x.root, ""); err != nil {
+			return err
+		}
+		return x.descend(0, 0)
+	})
+}
+
+// run validates the options and runs a single extraction into destination,
+// removing everything written when it fails.
+func (e Extractor) run(destination string, options Options, extract func(x *extraction) error) (Result, error) {
+	if err := validatePatterns(options.Include); err != nil {
+		return Result{}, err
+	}
+	if err := validatePatterns(options.Exclude); err != nil {
+		return Result{}, err
+	}
+
+	// Get the absolute destination path
+	destination, err := filepath.Abs(destination)
+	if err != nil {
+		return Result{}, err
+	}
+
+	x := extraction{
+		limits:       e.limits,
+		nesting:      e.nesting,
+		nameEncoding: e.nameEncoding,
+		options:      options,
+		exclude:      append(append([]string{}, e.excludes...), options.Exclude...),
+		root:         destination,
+		dirTimes:     map[string]time.Time{},
+	}
+
+	if err := extract(&x); err != nil {
+		return Result{}, x.cleanup(err)
+	}
+
+	// Directories are only stamped at the end, extracting their entries changes their modification time.
+	for dir, modTime := range x.dirTimes {
+		if err := os.Chtimes(dir, modTime, modTime); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Result{}, x.cleanup(err)
+		}
+	}
+
+	return Result{Files: x.files, Skipped: x.skipped}, nil
+}
+
+// extraction holds the state of a single call to Extract.
+type extraction struct {
+	limits       Limits
+	nesting      int
+	nameEncoding encoding.Encoding
+	options      Options
+	exclude      []string
+
+	// level is the nesting level of the archive that is being unpacked.
+	level int
+
+	// root is the destination of the outermost archive, file names are relative to it.
+	root string
+
+	// entries is the number of entries seen so far.
+	entries int
+
+	// written is the number of uncompressed bytes written so far.
+	written int64
+
+	// created are all files and directories created, in order, so they can be removed on failure.
+	created []string
+
+	// files are the regular files extracted so far.
+	files []File
+
+	// skipped are the names of the entries filtered out so far.
+	skipped []string
+
+	// dirTimes are the modification times of the directory entries, by path.
+	dirTimes map[string]time.Time
+}
+
+// extract unpacks the archive at source into destination, name is the original name of the archive.
+// Nested archives are extracted in place of the archive file until the nesting depth is reached.
+func (x *extraction) extract(source, name, destination string, level int) error {
+	start := len(x.files)
+	x.level = level
+	if err := x.unpack(source, name, destination); err != nil {
+		return err
+	}
+
+	return x.descend(start, level)
+}
+
+// descend extracts the archives among the files extracted since start, which were unpacked at level.
+func (x *extraction) descend(start, level int) error {
+	if level >= x.nesting {
+		return nil
+	}
+
+	files := append([]File(nil), x.files[start:]...)
+	x.files = x.files[:start]
+
+	for _, file := range files {
+		format, err := detectFile(file.Path)
+		if err != nil {
+			return err
+		}
+
+		// Spreadsheets are zip files as well, but are data files rather than archives.
+		if format == FormatUnknown || file.Format == sniffer.FormatXLSX || file.Format == sniffer.FormatODS {
+			// Files are only extracted regardless of the includes while they might be archives.
+			if !x.included(file.Name) {
+				if err := os.Remove(file.Path); err != nil {
+					return err
+				}
+				x.skipped = append(x.skipped, file.Name)
+				continue
+			}
+
+			x.files = append(x.files, file)
+			continue
+		}
+
+		if err := x.extractNested(file.Path, level+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractNested replaces the archive at file with a directory of the same name holding its contents.
+func (x *extraction) extractNested(file string, level int) error {
+	moved := filepath.Join(filepath.Dir(file), "."+filepath.Base(file)+".nested")
+	if err := os.Rename(file, moved); err != nil {
+		return err
+	}
+	x.created = append(x.created, moved)
+	defer os.Remove(moved)
+
+	return x.extract(moved, filepath.Base(file), file, level)
+}
+
+// unpack extracts a single archive without descending into nested archives.
+func (x *extraction) unpack(source, name, destination string) error {
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return x.unpackReader(f, name, destination, source)
+}
+
+// unpackReader extracts a single archive read from r. Zip archives are opened from source
+// instead, so they cannot be extracted when the archive is not stored in a file.
+func (x *extraction) unpackReader(r io.Reader, name, destination, source string) error {
+	raw := &counter{r: r}
+	br := bufio.NewReaderSize(raw, HeaderSize)
+	header, err := br.Peek(HeaderSize)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	switch Detect(header) {
+	case FormatZip:
+		if source == "" {
+			return fmt.Errorf("zip archive %s cannot be extracted while it is read: %w", name, domain.ErrBadRequest)
+		}
+		return x.extractZip(source, destination)
+	case FormatTar:
+		return x.extractTar(br, destination, nil)
+	case FormatGzip:
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip stream: %v: %w", err, domain.ErrBadRequest)
+		}
+		defer gr.Close()
+
+		if gr.Name != "" {
+			return x.extractCompressed(gr, gr.Name, gr.ModTime, destination, raw)
+		}
+		return x.extractCompressed(gr, trimCompressionExt(name), gr.ModTime, destination, raw)
+	case FormatBzip2:
+		return x.extractCompressed(bzip2.NewReader(br), trimCompressionExt(name), time.Time{}, destination, raw)
+	}
+
+	return fmt.Errorf("unsupported archive format for %s: %w", name, domain.ErrBadRequest)
+}
+
+// extractCompressed handles a decompressed stream, which is either a tarball
+// or a single compressed file that is written to destination as name.
+func (x *extraction) extractCompressed(r io.Reader, name string, modTime time.Time, destination string, raw *counter) error {
+	br := bufio.NewReaderSize(r, HeaderSize)
+	header, err := br.Peek(HeaderSize)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to decompress archive: %v: %w", err, domain.ErrBadRequest)
+	}
+
+	if isTar(header) {
+		return x.extractTar(br, destination, raw)
+	}
+
+	filePath, err := x.entry(destination, filepath.Base(name))
+	if err != nil {
+		return err
+	}
+
+	if skip, err := x.skip(filePath, false); skip || err != nil {
+		return err
+	}
+
+	compressed := func() int64 { return raw.n }
+	return x.writeFile(filePath, name, br, 0644, modTime, compressed)
+}
+
+// entry validates the next entry of the archive against the limits
+// and returns the path it should be extracted to.
+func (x *extraction) entry(destination, name string) (string, error) {
+	x.entries++
+	if err := x.limits.checkEntries(x.entries); err != nil {
+		return "", err
+	}
+
+	if err := x.limits.checkDepth(name); err != nil {
+		return "", err
+	}
+
+	// Check if file paths are not vulnerable to Zip Slip
+	return safeJoin(destination, name)
+}
+
+// skip reports whether the entry extracted to filePath is filtered out by the patterns, and records it when it is.
+// While the entry might be an archive that is extracted as well, the includes are checked once it has been extracted.
+func (x *extraction) skip(filePath string, dir bool) (bool, error) {
+	name, err := x.name(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	if !matchAny(x.exclude, name) && (dir || x.level < x.nesting || x.included(name)) {
+		return false, nil
+	}
+
+	x.skipped = append(x.skipped, name)
+	return true, nil
+}
+
+// included reports whether the entry name matches the includes.
+func (x *extraction) included(name string) bool {
+	return len(x.options.Include) == 0 || matchAny(x.options.Include, name)
+}
+
+// name returns the name of the entry extracted to filePath, relative to the root of the extraction.
+func (x *extraction) name(filePath string) (string, error) {
+	rel, err := filepath.Rel(x.root, filePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// mkdir creates the directory tree of dir and remembers every directory it created.
+func (x *extraction) mkdir(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		missing = append(missing, d)
+		if d == filepath.Dir(d) {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		x.created = append(x.created, missing[i])
+	}
+	return nil
+}
+
+// mkdirEntry creates the directory of a directory entry, which gets the
+// modification time of the entry once the extraction is done.
+func (x *extraction) mkdirEntry(dir string, modTime time.Time) error {
+	if err := x.mkdir(dir); err != nil {
+		return err
+	}
+
+	if !modTime.IsZero() {
+		x.dirTimes[dir] = modTime
+	}
+	return nil
+}
+
+// writeFile creates the file at filePath with its directory tree and copies the entry content into it,
+// hashing the content on the way so it can be listed in the manifest.
+func (x *extraction) writeFile(filePath, name string, r io.Reader, mode os.FileMode, modTime time.Time, compressed func() int64) error {
+	if err := x.mkdir(filepath.Dir(filePath)); err != nil {
+		return err
+	}
+
+	destinationFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer destinationFile.Close()
+	x.created = append(x.created, filePath)
+
+	g := &guard{
+		r:          r,
+		limits:     x.limits,
+		name:       name,
+		written:    &x.written,
+		compressed: compressed,
+	}
+
+	d := newDigest()
+	if _, err := io.Copy(io.MultiWriter(destinationFile, d), g); err != nil {
+		if errors.Is(err, domain.ErrTooLarge) || errors.Is(err, domain.ErrBadRequest) {
+			return err
+		}
+		return fmt.Errorf("failed to extract %s: %v: %w", name, err, domain.ErrBadRequest)
+	}
+
+	if err := destinationFile.Close(); err != nil {
+		return err
+	}
+
+	rel, err := x.name(filePath)
+	if err != nil {
+		return err
+	}
+
+	// The file keeps the modification time of its entry, entries without one get the time of extraction.
+	if modTime.IsZero() {
+		modTime = time.Now()
+	} else if err := os.Chtimes(filePath, modTime, modTime); err != nil {
+		return err
+	}
+
+	x.files = append(x.files, File{
+		Path:        filePath,
+		Name:        rel,
+		Size:        d.size,
+		SHA256:      d.sum(),
+		Mode:        fmt.Sprintf("%04o", mode.Perm()),
+		ModTime:     modTime.UTC(),
+		ContentType: d.contentType(),
+		Format:      d.format(),
+	})
+	return nil
+}
+
+// cleanup removes everything created by the extraction that failed with err, newest first. It returns err,
+// with the first path that could not be removed added to it.
+func (x *extraction) cleanup(err error) error {
+	var failed error
+	for i := len(x.created) - 1; i >= 0; i-- {
+		if err := os.Remove(x.created[i]); err != nil && !errors.Is(err, os.ErrNotExist) && failed == nil {
+			failed = err
+		}
+	}
+
+	if failed != nil {
+		return fmt.Errorf("%w, cleanup failed: %v", err, failed)
+	}
+	return err
+}
+
+// detectFile returns the format of the file at path.
+func detectFile(path string) (Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FormatUnknown, err
+	}
+	defer f.Close()
+
+	header := make([]byte, HeaderSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FormatUnknown, err
+	}
+
+	return Detect(header[:n]), nil
+}
+
+// safeJoin joins name onto destination and makes sure the result does
+// not escape the destination directory (Zip Slip).
+func safeJoin(destination, name string) (string, error) {
+	filePath := filepath.Join(destination, name)
+	if !strings.HasPrefix(filePath, filepath.Clean(destination)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid file path %s: %w", name, domain.ErrBadRequest)
+	}
+	return filePath, nil
+}
+
+// trimCompressionExt strips the compression extension of a single compressed file name.
+func trimCompressionExt(name string) string {
+	for _, ext := range []string{".gz", ".gzip", ".bz2", ".bzip2"} {
+		if strings.HasSuffix(strings.ToLower(name), ext) && len(name) > len(ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
@@ -0,0 +1,642 @@
+package extractor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const content = "a\tb\n1\t2\n"
+
+func zipArchive(t *testing.T, names ...string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tarArchive(t *testing.T, headers ...*tar.Header) []byte {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(content))
+		}
+		if err := w.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			if _, err := w.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, name string, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Name = name
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// tarball returns a tar archive holding the given files.
+func tarball(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for name, b := range files {
+		if err := w.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(b))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// nestedArchive returns a zip holding a plain file and a tarball that holds a zip archive.
+func nestedArchive(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	users := tarball(t, map[string][]byte{"users.tsv": []byte(content), "orders.zip": zipArchive(t, "orders.tsv")})
+
+	for name, b := range map[string][]byte{"a.tsv": []byte(content), "tables/users.tgz": gzipped(t, "", users)} {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// bombArchive returns a zip with a single entry of zeros that compresses extremely well.
+func bombArchive(t *testing.T, size int) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create("bomb.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(make([]byte, size)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// aesArchive returns a zip with a single deflated entry encrypted with WinZip AES-256 (AE-2).
+func aesArchive(t *testing.T, name, password string) []byte {
+	var deflated bytes.Buffer
+	fw, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	salt := []byte("0123456789abcdef")
+	key := pbkdf2.Key([]byte(password), salt, 1000, 2*32+2, sha1.New)
+	block, err := aes.NewCipher(key[:32])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted := deflated.Bytes()
+	for i := 0; i < len(encrypted); i += aes.BlockSize {
+		var counter, stream [aes.BlockSize]byte
+		binary.LittleEndian.PutUint64(counter[:], uint64(i/aes.BlockSize+1))
+		block.Encrypt(stream[:], counter[:])
+		for j := i; j < len(encrypted) && j < i+aes.BlockSize; j++ {
+			encrypted[j] ^= stream[j-i]
+		}
+	}
+
+	mac := hmac.New(sha1.New, key[32:64])
+	mac.Write(encrypted)
+
+	data := append(append(append(salt, key[64:]...), encrypted...), mac.Sum(nil)[:10]...)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Method:             99,
+		Flags:              0x1,
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(content)),
+		// Version 2, vendor AE, AES-256 and deflate as the actual compression method.
+		Extra: []byte{0x01, 0x99, 0x07, 0x00, 0x02, 0x00, 'A', 'E', 0x03, 0x08, 0x00},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// legacyArchive returns a zip whose entry names are not marked as UTF-8, the names are written as given.
+func legacyArchive(t *testing.T, headers ...*zip.FileHeader) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, h := range headers {
+		h.NonUTF8 = true
+		f, err := w.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// unicodePathExtra returns an Info-ZIP Unicode Path extra field naming the entry with the given legacy name.
+func unicodePathExtra(legacy, name string) []byte {
+	field := make([]byte, 9, 9+len(name))
+	binary.LittleEndian.PutUint16(field, unicodePathExtraID)
+	binary.LittleEndian.PutUint16(field[2:], uint16(5+len(name)))
+	field[4] = 1
+	binary.LittleEndian.PutUint32(field[5:], crc32.ChecksumIEEE([]byte(legacy)))
+	return append(field, name...)
+}
+
+func regular(name string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}
+}
+
+func TestExtract(t *testing.T) {
+	bz2, err := os.ReadFile("testdata/data.tsv.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Created with Info-ZIP: zip -P secret zipcrypto.zip data.tsv
+	zipCrypto, err := os.ReadFile("testdata/zipcrypto.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Created with Info-ZIP: zip -fz zip64.zip data.tsv
+	zip64, err := os.ReadFile("testdata/zip64.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		source        string
+		archive       []byte
+		limits        Limits
+		nesting       int
+		nameEncoding  string
+		password      string
+		stream        bool
+		include       []string
+		exclude       []string
+		expectedFiles []string
+		// expectedSkipped are the skipped entries, sorted.
+		expectedSkipped []string
+		expectedErr     error
+	}{
+		{
+			name:          "zip archive",
+			source:        "upload",
+			archive:       zipArchive(t, "a.tsv", "dir/b.tsv"),
+			expectedFiles: []string{"a.tsv", "dir/b.tsv"},
+		},
+		{
+			name:          "tar archive",
+			source:        "upload",
+			archive:       tarArchive(t, &tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755}, regular("dir/a.tsv")),
+			expectedFiles: []string{"dir/a.tsv"},
+		},
+		{
+			name:          "tar.gz archive",
+			source:        "upload.tgz",
+			archive:       gzipped(t, "", tarArchive(t, regular("a.tsv"), regular("b.tsv"))),
+			expectedFiles: []string{"a.tsv", "b.tsv"},
+		},
+		{
+			name:          "streamed tar.gz archive",
+			source:        "upload.tgz",
+			archive:       gzipped(t, "", tarArchive(t, regular("a.tsv"), regular("b.tsv"))),
+			stream:        true,
+			expectedFiles: []string{"a.tsv", "b.tsv"},
+		},
+		{
+			name:          "streamed nested archives",
+			source:        "upload.tgz",
+			archive:       gzipped(t, "", tarball(t, map[string][]byte{"a.tsv": []byte(content), "orders.zip": zipArchive(t, "orders.tsv")})),
+			stream:        true,
+			nesting:       1,
+			expectedFiles: []string{"a.tsv", "orders.zip/orders.tsv"},
+		},
+		{
+			name:        "streamed zip archive",
+			source:      "upload",
+			archive:     zipArchive(t, "a.tsv"),
+			stream:      true,
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:          "single gzip file named by its header",
+			source:        "upload",
+			archive:       gzipped(t, "data.tsv", []byte(content)),
+			expectedFiles: []string{"data.tsv"},
+		},
+		{
+			name:          "single gzip file named by its source",
+			source:        "data.tsv.gz",
+			archive:       gzipped(t, "", []byte(content)),
+			expectedFiles: []string{"data.tsv"},
+		},
+		{
+			name:          "single bzip2 file",
+			source:        "data.tsv.bz2",
+			archive:       bz2,
+			expectedFiles: []string{"data.tsv"},
+		},
+		{
+			name:          "zipcrypto archive",
+			source:        "upload",
+			archive:       zipCrypto,
+			password:      "secret",
+			expectedFiles: []string{"data.tsv"},
+		},
+		{
+			name:        "zipcrypto archive with wrong password",
+			source:      "upload",
+			archive:     zipCrypto,
+			password:    "guess",
+			expectedErr: domain.ErrWrongPassword,
+		},
+		{
+			name:        "zipcrypto archive without password",
+			source:      "upload",
+			archive:     zipCrypto,
+			expectedErr: domain.ErrWrongPassword,
+		},
+		{
+			name:          "aes-256 archive",
+			source:        "upload",
+			archive:       aesArchive(t, "data.tsv", "secret"),
+			password:      "secret",
+			expectedFiles: []string{"data.tsv"},
+		},
+		{
+			name:          "zip64 archive",
+			source:        "upload",
+			archive:       zip64,
+			expectedFiles: []string{"data.tsv"},
+		},
+		{
+			name:          "cp437 names",
+			source:        "upload",
+			archive:       legacyArchive(t, &zip.FileHeader{Name: "\x8epfel\\caf\x82.tsv"}),
+			expectedFiles: []string{"Äpfel/café.tsv"},
+		},
+		{
+			name:          "shift-jis names",
+			source:        "upload",
+			archive:       legacyArchive(t, &zip.FileHeader{Name: "\x83f\x81[\x83^\\\x95\\.tsv"}),
+			expectedFiles: []string{"データ/表.tsv"},
+		},
+		{
+			name:          "configured name encoding",
+			source:        "upload",
+			archive:       legacyArchive(t, &zip.FileHeader{Name: "\x95\\.tsv"}),
+			nameEncoding:  "shift_jis",
+			expectedFiles: []string{"表.tsv"},
+		},
+		{
+			name:          "unsigned utf-8 names",
+			source:        "upload",
+			archive:       legacyArchive(t, &zip.FileHeader{Name: "données/été.tsv"}),
+			expectedFiles: []string{"données/été.tsv"},
+		},
+		{
+			name:          "unicode path extra field",
+			source:        "upload",
+			archive:       legacyArchive(t, &zip.FileHeader{Name: "caf\x82.tsv", Extra: unicodePathExtra("caf\x82.tsv", "café.tsv")}),
+			nameEncoding:  "shift_jis",
+			expectedFiles: []string{"café.tsv"},
+		},
+		{
+			name:        "aes-256 archive with wrong password",
+			source:      "upload",
+			archive:     aesArchive(t, "data.tsv", "secret"),
+			password:    "guess",
+			expectedErr: domain.ErrWrongPassword,
+		},
+		{
+			name:          "nested archives",
+			source:        "upload",
+			archive:       nestedArchive(t),
+			nesting:       2,
+			expectedFiles: []string{"a.tsv", "tables/users.tgz/orders.zip/orders.tsv", "tables/users.tgz/users.tsv"},
+		},
+		{
+			name:        "nested archives count towards the limits",
+			source:      "upload",
+			archive:     nestedArchive(t),
+			nesting:     2,
+			limits:      Limits{MaxEntries: 4},
+			expectedErr: domain.ErrTooLarge,
+		},
+		{
+			name:            "default excludes",
+			source:          "upload",
+			archive:         zipArchive(t, "a.tsv", "__MACOSX/._a.tsv", ".DS_Store"),
+			expectedFiles:   []string{"a.tsv"},
+			expectedSkipped: []string{".DS_Store", "__MACOSX/._a.tsv"},
+		},
+		{
+			name:            "include and exclude patterns",
+			source:          "upload",
+			archive:         zipArchive(t, "data/a.tsv", "data/b.csv", "README.md", "img/logo.png"),
+			include:         []string{"data/*"},
+			exclude:         []string{"*.csv"},
+			expectedFiles:   []string{"data/a.tsv"},
+			expectedSkipped: []string{"README.md", "data/b.csv", "img/logo.png"},
+		},
+		{
+			name:            "include patterns in nested archives",
+			source:          "upload",
+			archive:         nestedArchive(t),
+			nesting:         2,
+			include:         []string{"users.tsv"},
+			expectedFiles:   []string{"tables/users.tgz/users.tsv"},
+			expectedSkipped: []string{"a.tsv", "tables/users.tgz/orders.zip/orders.tsv"},
+		},
+		{
+			name:        "invalid pattern",
+			source:      "upload",
+			archive:     zipArchive(t, "a.tsv"),
+			include:     []string{"[a-"},
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "zip slip",
+			source:      "upload",
+			archive:     zipArchive(t, "../evil.tsv"),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "tar slip",
+			source:      "upload",
+			archive:     tarArchive(t, regular("../../evil.tsv")),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "tar symlink",
+			source:      "upload",
+			archive:     tarArchive(t, &tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "tar hard link",
+			source:      "upload",
+			archive:     tarArchive(t, regular("a.tsv"), &tar.Header{Name: "link", Typeflag: tar.TypeLink, Linkname: "a.tsv"}),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "tar device",
+			source:      "upload",
+			archive:     tarArchive(t, &tar.Header{Name: "dev", Typeflag: tar.TypeChar}),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "unknown format",
+			source:      "upload.zip",
+			archive:     []byte(content),
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "too many entries",
+			source:      "upload",
+			archive:     zipArchive(t, "a.tsv", "b.tsv", "c.tsv"),
+			limits:      Limits{MaxEntries: 2},
+			expectedErr: domain.ErrTooLarge,
+		},
+		{
+			name:        "too many bytes",
+			source:      "upload",
+			archive:     tarArchive(t, regular("a.tsv"), regular("b.tsv")),
+			limits:      Limits{MaxBytes: int64(len(content)) + 1},
+			expectedErr: domain.ErrTooLarge,
+		},
+		{
+			name:        "compression ratio",
+			source:      "upload",
+			archive:     bombArchive(t, 4*ratioGrace),
+			limits:      Limits{MaxRatio: 100},
+			expectedErr: domain.ErrTooLarge,
+		},
+		{
+			name:        "nested too deep",
+			source:      "upload",
+			archive:     zipArchive(t, "a/b/c/d.tsv"),
+			limits:      Limits{MaxDepth: 2},
+			expectedErr: domain.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, tt.source)
+			if err := os.WriteFile(source, tt.archive, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			destination := filepath.Join(dir, "files")
+			options := Options{
+				Password: tt.password,
+				Include:  tt.include,
+				Exclude:  tt.exclude,
+			}
+			e := NewExtractor(tt.limits, WithNesting(tt.nesting), WithNameEncoding(tt.nameEncoding))
+
+			var result Result
+			if tt.stream {
+				result, err = e.ExtractStream(bytes.NewReader(tt.archive), tt.source, destination, options)
+			} else {
+				result, err = e.Extract(source, destination, options)
+			}
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+
+			// A failed extraction must not leave partial output behind.
+			if _, err := os.Stat(destination); tt.expectedErr != nil && !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected destination to be removed, got = %v", err)
+			}
+
+			sum := sha256.Sum256([]byte(content))
+			var got []string
+			for _, file := range result.Files {
+				got = append(got, file.Name)
+
+				b, err := os.ReadFile(file.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != content {
+					t.Errorf("expected content of %s to be = %q, got = %q", file.Name, content, b)
+				}
+				if file.Size != int64(len(content)) || file.SHA256 != hex.EncodeToString(sum[:]) {
+					t.Errorf("expected %s to have size = %d and checksum = %x, got = %d and %s", file.Name, len(content), sum, file.Size, file.SHA256)
+				}
+			}
+
+			sort.Strings(got)
+			if len(got) != len(tt.expectedFiles) {
+				t.Fatalf("expected files to be = %v, got = %v", tt.expectedFiles, got)
+			}
+			for i := range got {
+				if got[i] != tt.expectedFiles[i] {
+					t.Errorf("expected files to be = %v, got = %v", tt.expectedFiles, got)
+				}
+			}
+
+			sort.Strings(result.Skipped)
+			if strings.Join(result.Skipped, ",") != strings.Join(tt.expectedSkipped, ",") {
+				t.Errorf("expected skipped entries to be = %v, got = %v", tt.expectedSkipped, result.Skipped)
+			}
+		})
+	}
+}
+
+func TestExtractModTime(t *testing.T) {
+	modTime := time.Date(2020, time.January, 2, 3, 4, 6, 0, time.UTC)
+
+	var zipped bytes.Buffer
+	w := zip.NewWriter(&zipped)
+	for _, name := range []string{"dir/", "dir/a.tsv"} {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Modified: modTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(name, "/") {
+			if _, err := f.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dirHeader := &tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime}
+	fileHeader := regular("dir/a.tsv")
+	fileHeader.ModTime = modTime
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{
+			name:    "zip archive",
+			archive: zipped.Bytes(),
+		},
+		{
+			name:    "tar archive",
+			archive: tarArchive(t, dirHeader, fileHeader),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "upload")
+			if err := os.WriteFile(source, tt.archive, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			destination := filepath.Join(dir, "files")
+			result, err := NewExtractor(Limits{}).Extract(source, destination, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Files) != 1 || !result.Files[0].ModTime.Equal(modTime) {
+				t.Fatalf("expected a single file modified at %s, got = %v", modTime, result.Files)
+			}
+
+			for _, name := range []string{"dir", "dir/a.tsv"} {
+				info, err := os.Stat(filepath.Join(destination, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !info.ModTime().Equal(modTime) {
+					t.Errorf("expected %s to be modified at %s, got = %s", name, modTime, info.ModTime())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package extractor
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+)
+
+// DefaultExcludes are the metadata files operating systems add to archives, they are never data.
+var DefaultExcludes = []string{"__MACOSX", ".DS_Store", "._*", "Thumbs.db", "desktop.ini"}
+
+// validatePatterns returns an error when one of the glob patterns is malformed.
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, domain.ErrBadRequest)
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether name matches any of the glob patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether the slash separated entry name matches the glob pattern. A pattern
+// without a slash matches any element of the name, so "__MACOSX" matches everything inside such
+// a directory and "*.png" matches images at any depth. A pattern with a slash matches the name
+// from its root, or one of the directories the entry is in.
+func match(pattern, name string) bool {
+	elems := strings.Split(strings.Trim(name, "/"), "/")
+
+	if !strings.Contains(strings.Trim(pattern, "/"), "/") {
+		for _, elem := range elems {
+			if ok, _ := path.Match(strings.Trim(pattern, "/"), elem); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	pattern = strings.Trim(pattern, "/")
+	for i := range elems {
+		if ok, _ := path.Match(pattern, strings.Join(elems[:i+1], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
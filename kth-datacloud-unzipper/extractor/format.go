@@ -0,0 +1,94 @@
+package extractor
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Format is an archive or compression format detected from the magic bytes of a file.
+type Format string
+
+const (
+	// FormatUnknown is returned when the content does not match any supported format.
+	FormatUnknown = Format("")
+
+	// FormatZip is a zip archive.
+	FormatZip = Format("zip")
+
+	// FormatTar is an uncompressed tar archive.
+	FormatTar = Format("tar")
+
+	// FormatGzip is a gzip compressed stream, either a tarball or a single file.
+	FormatGzip = Format("gzip")
+
+	// FormatBzip2 is a bzip2 compressed stream, either a tarball or a single file.
+	FormatBzip2 = Format("bzip2")
+)
+
+// HeaderSize is the number of bytes needed to detect any of the supported formats,
+// it is the size of a single tar header block.
+const HeaderSize = 512
+
+var (
+	zipMagic      = [][]byte{[]byte("PK\x03\x04"), []byte("PK\x05\x06"), []byte("PK\x07\x08")}
+	gzipMagic     = []byte{0x1f, 0x8b}
+	bzip2Magic    = []byte("BZh")
+	tarMagic      = []byte("ustar")
+	tarMagicIndex = 257
+)
+
+// Streamable reports whether archives of the format can be extracted while they are read.
+// Zip archives cannot, their central directory is at the end of the archive.
+func (f Format) Streamable() bool {
+	return f == FormatTar || f == FormatGzip || f == FormatBzip2
+}
+
+// Detect returns the format of the content starting with header.
+func Detect(header []byte) Format {
+	for _, magic := range zipMagic {
+		if bytes.HasPrefix(header, magic) {
+			return FormatZip
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return FormatGzip
+	case bytes.HasPrefix(header, bzip2Magic):
+		return FormatBzip2
+	case isTar(header):
+		return FormatTar
+	}
+
+	return FormatUnknown
+}
+
+// isTar reports whether header is a tar header block, either by its ustar magic
+// or, for old v7 archives without magic, by a valid header checksum.
+func isTar(header []byte) bool {
+	if len(header) < HeaderSize {
+		return false
+	}
+
+	if bytes.HasPrefix(header[tarMagicIndex:], tarMagic) {
+		return true
+	}
+
+	// The checksum is the sum of all header bytes with the checksum field itself taken as spaces.
+	field := strings.Trim(string(header[148:156]), " \x00")
+	expected, err := strconv.ParseInt(field, 8, 64)
+	if err != nil {
+		return false
+	}
+
+	var sum int64
+	for i, b := range header[:HeaderSize] {
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		sum += int64(b)
+	}
+
+	return sum == expected
+}
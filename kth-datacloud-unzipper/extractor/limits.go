@@ -0,0 +1,102 @@
+package extractor
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+)
+
+// ratioGrace is the number of bytes an entry may expand to before its compression ratio is checked,
+// so small but highly compressible files like sparse tables are not rejected.
+const ratioGrace = 1 << 20 // 1 MiB.
+
+// Limits protects the shared volume against archive bombs, a zero value disables the limit.
+type Limits struct {
+	// MaxBytes is the maximum total number of uncompressed bytes extracted from an archive.
+	MaxBytes int64
+
+	// MaxEntries is the maximum number of entries, files and directories, in an archive.
+	MaxEntries int
+
+	// MaxRatio is the maximum ratio between the uncompressed and compressed size of an entry.
+	MaxRatio int64
+
+	// MaxDepth is the maximum number of directories an entry path may be nested in.
+	MaxDepth int
+}
+
+// DefaultLimits are the limits used when none are configured.
+var DefaultLimits = Limits{
+	MaxBytes:   10 << 30, // 10 GiB.
+	MaxEntries: 10000,
+	MaxRatio:   200,
+	MaxDepth:   16,
+}
+
+// checkEntries returns an error when count exceeds the maximum number of entries.
+func (l Limits) checkEntries(count int) error {
+	if l.MaxEntries > 0 && count > l.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries: %w", l.MaxEntries, domain.ErrTooLarge)
+	}
+	return nil
+}
+
+// checkDepth returns an error when the entry name is nested deeper than the maximum depth.
+func (l Limits) checkDepth(name string) error {
+	depth := strings.Count(strings.Trim(filepath.ToSlash(filepath.Clean(name)), "/"), "/")
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return fmt.Errorf("entry %s is nested deeper than %d directories: %w", name, l.MaxDepth, domain.ErrBadRequest)
+	}
+	return nil
+}
+
+// guard wraps the decompressed content of an entry and fails the read as soon as
+// the total size or the compression ratio limit is exceeded.
+type guard struct {
+	r      io.Reader
+	limits Limits
+	name   string
+
+	// written is the total number of bytes extracted so far, shared between all entries.
+	written *int64
+
+	// read is the number of bytes read from this entry.
+	read int64
+
+	// compressed returns the number of compressed bytes backing this entry,
+	// nil means the entry is stored uncompressed.
+	compressed func() int64
+}
+
+func (g *guard) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	g.read += int64(n)
+	*g.written += int64(n)
+
+	if g.limits.MaxBytes > 0 && *g.written > g.limits.MaxBytes {
+		return n, fmt.Errorf("archive expands to more than %d bytes: %w", g.limits.MaxBytes, domain.ErrTooLarge)
+	}
+
+	if g.limits.MaxRatio > 0 && g.compressed != nil && g.read > ratioGrace {
+		if compressed := g.compressed(); compressed > 0 && g.read/compressed > g.limits.MaxRatio {
+			return n, fmt.Errorf("entry %s exceeds the compression ratio of %d: %w", g.name, g.limits.MaxRatio, domain.ErrTooLarge)
+		}
+	}
+
+	return n, err
+}
+
+// counter counts the bytes read from the underlying reader.
+type counter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *counter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
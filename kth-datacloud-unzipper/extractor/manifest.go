@@ -0,0 +1,107 @@
+package extractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/sniffer"
+)
+
+// ManifestName is the file name manifests are written under.
+const ManifestName = "manifest.json"
+
+// File describes a single file produced by an extraction.
+type File struct {
+	// Path is the absolute path of the extracted file.
+	Path string `json:"-"`
+
+	// Name is the path of the file relative to the extraction destination.
+	Name string `json:"path"`
+
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	Mode        string    `json:"mode"`
+	ModTime     time.Time `json:"mod_time"`
+	ContentType string    `json:"content_type"`
+
+	// Format is the data format sniffed from the content, used to route the file.
+	Format sniffer.Format `json:"format"`
+}
+
+// Manifest lists every file extracted from an archive, so downstream stages
+// can verify they are reading complete and untampered inputs.
+type Manifest struct {
+	Archive     string    `json:"archive"`
+	ExtractedAt time.Time `json:"extracted_at"`
+	Files       []File    `json:"files"`
+
+	// Skipped are the entries of the archive that were filtered out and not extracted.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// NewManifest returns the manifest for the result of extracting archive.
+func NewManifest(archive string, result Result) Manifest {
+	files := result.Files
+	if files == nil {
+		files = []File{}
+	}
+
+	return Manifest{
+		Archive:     archive,
+		ExtractedAt: time.Now().UTC(),
+		Files:       files,
+		Skipped:     result.Skipped,
+	}
+}
+
+// Write writes the manifest as indented JSON to path.
+func (m Manifest) Write(path string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0644)
+}
+
+// digest hashes everything written to it and keeps the first bytes to detect the content type and format.
+type digest struct {
+	hash hash.Hash
+	head []byte
+	size int64
+}
+
+func newDigest() *digest {
+	return &digest{
+		hash: sha256.New(),
+	}
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	if missing := sniffer.SampleSize - len(d.head); missing > 0 {
+		if missing > len(p) {
+			missing = len(p)
+		}
+		d.head = append(d.head, p[:missing]...)
+	}
+
+	d.size += int64(len(p))
+	return d.hash.Write(p)
+}
+
+func (d *digest) sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+func (d *digest) contentType() string {
+	return http.DetectContentType(d.head)
+}
+
+func (d *digest) format() sniffer.Format {
+	return sniffer.Detect(d.head, d.size <= int64(len(d.head)))
+}
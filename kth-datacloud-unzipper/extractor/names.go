@@ -0,0 +1,134 @@
+package extractor
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+const (
+	// flagUTF8 marks a zip entry whose name is encoded as UTF-8.
+	flagUTF8 = 0x800
+
+	// unicodePathExtraID is the ID of the Info-ZIP Unicode Path extra field, it holds
+	// the UTF-8 name of an entry whose name is stored in a legacy encoding.
+	unicodePathExtraID = 0x7075
+
+	// minJapaneseRunes is the number of Japanese characters a name has to decode to before it is
+	// taken as Shift-JIS, shorter names are just as likely to be CP437 with a few accented letters.
+	minJapaneseRunes = 2
+)
+
+// NameEncodings are the legacy encodings zip entry names can be decoded from, by name.
+var NameEncodings = map[string]encoding.Encoding{
+	"cp437":     charmap.CodePage437,
+	"shift_jis": japanese.ShiftJIS,
+}
+
+// entryName returns the name of the zip entry as UTF-8 with slashes as separators. Names that are
+// not marked as UTF-8 are taken from the Unicode Path extra field when there is one, and decoded
+// from legacy otherwise. A nil legacy encoding detects either CP437 or Shift-JIS per name.
+func entryName(f *zip.File, legacy encoding.Encoding) string {
+	if f.Flags&flagUTF8 != 0 {
+		return f.Name
+	}
+
+	name, ok := unicodePath(f)
+	if !ok {
+		name = decodeName(f.Name, legacy)
+	}
+
+	// Older Windows tools separate directories with backslashes. They are only replaced once the
+	// name is decoded, since the second byte of a Shift-JIS character can be a backslash.
+	return strings.ReplaceAll(name, `\`, "/")
+}
+
+// unicodePath returns the name in the Unicode Path extra field of the entry,
+// as long as the field was written for the name the entry has now.
+func unicodePath(f *zip.File) (string, bool) {
+	field, ok := extraField(f.Extra, unicodePathExtraID)
+	if !ok || len(field) < 5 || field[0] != 1 {
+		return "", false
+	}
+
+	if binary.LittleEndian.Uint32(field[1:]) != crc32.ChecksumIEEE([]byte(f.Name)) {
+		return "", false
+	}
+
+	name := string(field[5:])
+	return name, utf8.ValidString(name)
+}
+
+// decodeName decodes name from legacy, or from the detected encoding when legacy is nil.
+// Names that are valid UTF-8 are kept as they are, many tools write UTF-8 without marking it.
+func decodeName(name string, legacy encoding.Encoding) string {
+	if legacy == nil {
+		if utf8.ValidString(name) {
+			return name
+		}
+		legacy = detectEncoding(name)
+	}
+
+	decoded, err := legacy.NewDecoder().String(name)
+	if err != nil {
+		return name
+	}
+	return decoded
+}
+
+// detectEncoding returns Shift-JIS when name decodes to Japanese text with it, and CP437,
+// the encoding of the zip specification, otherwise.
+func detectEncoding(name string) encoding.Encoding {
+	decoded, err := japanese.ShiftJIS.NewDecoder().String(name)
+	if err != nil {
+		return charmap.CodePage437
+	}
+
+	count := 0
+	for _, r := range decoded {
+		switch {
+		case r < utf8.RuneSelf:
+		case isJapanese(r):
+			count++
+		default:
+			// Invalid bytes decode to the replacement character, and half width katakana
+			// share their bytes with the accented letters of CP437.
+			return charmap.CodePage437
+		}
+	}
+
+	if count < minJapaneseRunes {
+		return charmap.CodePage437
+	}
+	return japanese.ShiftJIS
+}
+
+// isJapanese reports whether r is a full width Japanese character: punctuation, kana, a kanji or a full width letter.
+func isJapanese(r rune) bool {
+	return (r >= 0x3000 && r <= 0x30ff) || (r >= 0x4e00 && r <= 0x9fff) || (r >= 0xff01 && r <= 0xff5e)
+}
+
+// extraField returns the content of the extra field with the given ID.
+func extraField(extra []byte, id uint16) ([]byte, bool) {
+	for len(extra) >= 4 {
+		fieldID := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+
+		if fieldID == id {
+			return extra[:size], true
+		}
+		extra = extra[size:]
+	}
+
+	return nil, false
+}
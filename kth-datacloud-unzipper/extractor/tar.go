@@ -0,0 +1,63 @@
+package extractor
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+)
+
+// extractTar reads a tar stream from r and writes its regular files and directories to destination.
+// Links and special files are rejected since they can point outside of the destination. When the
+// tar stream is compressed, raw counts the compressed bytes read to enforce the compression ratio.
+func (x *extraction) extractTar(r io.Reader, destination string, raw *counter) error {
+	reader := tar.NewReader(r)
+
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive: %v: %w", err, domain.ErrBadRequest)
+		}
+
+		filePath, err := x.entry(destination, header.Name)
+		if err != nil {
+			return err
+		}
+
+		// Skipped entries are not read, the tar reader discards their content on the next entry.
+		if skip, err := x.skip(filePath, header.Typeflag == tar.TypeDir); skip || err != nil {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := x.mkdirEntry(filePath, header.ModTime); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			var compressed func() int64
+			if raw != nil {
+				start := raw.n
+				compressed = func() int64 { return raw.n - start }
+			}
+
+			if err := x.writeFile(filePath, header.Name, reader, header.FileInfo().Mode().Perm(), header.ModTime, compressed); err != nil {
+				return err
+			}
+		case tar.TypeSymlink, tar.TypeLink:
+			return fmt.Errorf("links are not allowed, entry %s: %w", header.Name, domain.ErrBadRequest)
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			return fmt.Errorf("special files are not allowed, entry %s: %w", header.Name, domain.ErrBadRequest)
+		default:
+			return fmt.Errorf("unsupported entry %s of type %q: %w", header.Name, header.Typeflag, domain.ErrBadRequest)
+		}
+	}
+}
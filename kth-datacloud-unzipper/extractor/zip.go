@@ -0,0 +1,76 @@
+package extractor
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+)
+
+func (x *extraction) extractZip(source, destination string) error {
+	// 1. Open the zip file
+	reader, err := zip.OpenReader(source)
+	if err != nil {
+		return fmt.Errorf("failed to open zip archive: %v: %w", err, domain.ErrBadRequest)
+	}
+	defer reader.Close()
+
+	// 2. The central directory tells us the number of entries before extracting anything
+	if err := x.limits.checkEntries(x.entries + len(reader.File)); err != nil {
+		return err
+	}
+
+	// 3. Iterate over zip files inside the archive and unzip each of them
+	for _, f := range reader.File {
+		if err := x.unzipFile(f, destination); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unzipFile extracts a single zip entry.
+func (x *extraction) unzipFile(f *zip.File, destination string) error {
+	// 4. Check the entry against the limits and make sure it is not vulnerable to Zip Slip
+	name := entryName(f, x.nameEncoding)
+	filePath, err := x.entry(destination, name)
+	if err != nil {
+		return err
+	}
+
+	// 5. Skip filtered entries and create the directory tree, directories of
+	// Windows tools only end with a slash once the name is decoded
+	mode := f.Mode()
+	dir := mode.IsDir() || strings.HasSuffix(name, "/")
+	if skip, err := x.skip(filePath, dir); skip || err != nil {
+		return err
+	}
+
+	switch {
+	case dir:
+		return x.mkdirEntry(filePath, f.Modified)
+	case !mode.IsRegular():
+		return fmt.Errorf("unsupported entry %s of type %s: %w", name, mode.Type(), domain.ErrBadRequest)
+	}
+
+	// 6. Unzip the content of a file, decrypting it when needed, and copy it to the destination file
+	zippedFile, err := openZipFile(f, x.options.Password)
+	if errors.Is(err, domain.ErrWrongPassword) || errors.Is(err, domain.ErrBadRequest) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open entry %s: %v: %w", name, err, domain.ErrBadRequest)
+	}
+	defer zippedFile.Close()
+
+	// The compressed size is what the entry is read from, so it can be trusted for the ratio.
+	var compressed func() int64
+	if f.Method != zip.Store {
+		compressed = func() int64 { return int64(f.CompressedSize64) }
+	}
+
+	return x.writeFile(filePath, name, zippedFile, mode.Perm(), f.Modified, compressed)
+}
@@ -29,9 +29,17 @@ func (e ResponseEncoder) Error(ctx context.Context, w http.ResponseWriter, err e
 	}
 
 	statusCode := http.StatusInternalServerError
-	switch errors.Unwrap(err) {
-	case domain.ErrBadRequest:
+	switch {
+	case errors.Is(err, domain.ErrBadRequest):
 		statusCode = http.StatusBadRequest
+	case errors.Is(err, domain.ErrNotFound):
+		statusCode = http.StatusNotFound
+	case errors.Is(err, domain.ErrTooLarge):
+		statusCode = http.StatusRequestEntityTooLarge
+	case errors.Is(err, domain.ErrConflict):
+		statusCode = http.StatusConflict
+	case errors.Is(err, domain.ErrWrongPassword):
+		statusCode = http.StatusUnprocessableEntity
 	}
 
 	e.Respond(ctx, w, resp, statusCode)
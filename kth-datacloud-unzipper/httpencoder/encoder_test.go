@@ -86,6 +86,26 @@ func TestError(t *testing.T) {
 			err:          fmt.Errorf("something went wrong %w", domain.ErrBadRequest),
 			expectedCode: http.StatusBadRequest,
 		},
+		{
+			name:         "not found",
+			err:          fmt.Errorf("something went wrong %w", domain.ErrNotFound),
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "request too large",
+			err:          fmt.Errorf("something went wrong %w", domain.ErrTooLarge),
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:         "conflict",
+			err:          fmt.Errorf("something went wrong %w", domain.ErrConflict),
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "wrong archive password",
+			err:          fmt.Errorf("something went wrong %w", domain.ErrWrongPassword),
+			expectedCode: http.StatusUnprocessableEntity,
+		},
 		{
 			name:         "internal server error",
 			err:          fmt.Errorf("something went wrong %w", domain.ErrInternal),
@@ -43,7 +43,8 @@ func (s Server) Open() error {
 	}
 
 	server := http.Server{
-		Handler: http.TimeoutHandler(s.handler(), s.timeout, "http request timed out"),
+		Handler:           s.handler(),
+		ReadHeaderTimeout: s.timeout,
 	}
 
 	s.logger.Info(fmt.Sprintf("http server listening on %s", s.address))
@@ -60,6 +61,9 @@ func (s Server) handler() http.Handler {
 	// Recovers and logs panics.
 	router.Use(chimiddleware.Recoverer)
 
+	// Limits the time spent on a request.
+	router.Use(s.timeoutMiddleware)
+
 	// Health endpoint.
 	router.Use(chimiddleware.Heartbeat("/health"))
 
@@ -73,3 +77,18 @@ func (s Server) handler() http.Handler {
 
 	return router
 }
+
+// timeoutMiddleware limits the time spent on a request, except for requests sending
+// a body since uploading an archive takes as long as the client needs to send it.
+func (s Server) timeoutMiddleware(next http.Handler) http.Handler {
+	limited := http.TimeoutHandler(next, s.timeout, "http request timed out")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			next.ServeHTTP(w, r)
+		default:
+			limited.ServeHTTP(w, r)
+		}
+	})
+}
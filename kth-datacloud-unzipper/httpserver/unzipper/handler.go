@@ -1,122 +1,270 @@
 package unzipper
 
 import (
-	"archive/zip"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"mime"
+	"net/url"
+	"path"
 	"path/filepath"
-	"strings"
+	"strconv"
 
 	"net/http"
 
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"github.com/amus-sal/kth-datacloud-unzipper/extractor"
+	"github.com/amus-sal/kth-datacloud-unzipper/job"
+	"github.com/amus-sal/kth-datacloud-unzipper/upload"
 	"github.com/go-chi/chi/v5"
 )
 
-//go:generate moq -out handler_mocks.go . encoder stripeService
+//go:generate moq -out handler_mocks.go . encoder ingestService
+
+const (
+	// archiveName is the name the uploaded archive is stored under when the client did not send one.
+	archiveName = "archive"
+
+	// formField is the multipart form field holding the uploaded archive.
+	formField = "file"
+
+	// passwordHeader is the header holding the password of an encrypted archive. It is a header
+	// rather than a query parameter so it does not end up in access logs.
+	passwordHeader = "X-Archive-Password"
+
+	// idempotencyHeader is the header holding a client chosen key, requests with the same key create a single job.
+	idempotencyHeader = "Idempotency-Key"
+)
 
 type encoder interface {
 	Respond(ctx context.Context, w http.ResponseWriter, payload interface{}, statusCode int)
 	Error(ctx context.Context, w http.ResponseWriter, err error)
 }
 
-type Handler struct {
-	encoder   encoder
-	publisher publisher
+type ingestService interface {
+	Create(ctx context.Context, idempotencyKey string, force bool) (job.Job, bool, error)
+	Job(ctx context.Context, id string) (job.Job, error)
+	Options(dataset string, options extractor.Options) (extractor.Options, error)
+	Receive(ctx context.Context, id string, body io.Reader, name string, size int64, options extractor.Options) (job.Job, bool, error)
+	CreateUpload(ctx context.Context, name string, size int64) (upload.Upload, error)
+	Upload(ctx context.Context, id string) (upload.Upload, error)
+	WriteUpload(ctx context.Context, id string, offset int64, r io.Reader) (upload.Upload, error)
+	DeleteUpload(ctx context.Context, id string) error
+	FinishUpload(ctx context.Context, id string, idempotencyKey string, force bool, options extractor.Options) (job.Job, bool, error)
+	Fetch(ctx context.Context, id string, source string, name string, checksum string, options extractor.Options)
 }
-type publisher interface {
-	FileCreated(ctx context.Context, eventID string, filePath string) error
+
+type Handler struct {
+	encoder encoder
+	service ingestService
 }
 
-// NewHandler returns a new Stripe handler with all dependencies.
-func NewHandler(encoder encoder, publisher publisher) Handler {
+// NewHandler returns a new unzipper handler with all dependencies.
+func NewHandler(encoder encoder, service ingestService) Handler {
 	return Handler{
-		encoder:   encoder,
-		publisher: publisher,
+		encoder: encoder,
+		service: service,
 	}
 }
 
 func (h Handler) Routes(r chi.Router) {
 	r.Post("/", h.postEvent)
+	r.Route("/uploads", h.uploadRoutes)
+	r.Get("/{id}", h.getJob)
+}
+
+// sourceRequest asks the unzipper to download the archive itself.
+type sourceRequest struct {
+	URL      string   `json:"url"`
+	SHA256   string   `json:"sha256"`
+	Dataset  string   `json:"dataset"`
+	Password string   `json:"password"`
+	Include  []string `json:"include"`
+	Exclude  []string `json:"exclude"`
+	Force    bool     `json:"force"`
 }
 
+// postEvent receives an archive either as a multipart form upload or as the raw request body.
+// Tarballs are extracted while they are received, other archives are stored on the shared volume
+// and extracted in the background. A JSON body with a source URL makes the unzipper download
+// the archive instead. Publishing happens in the background, the response holds the job to poll
+// for the outcome. Encrypted archives are opened with the password header or
+// with the password of the dataset query parameter. The repeatable include and exclude query
+// parameters select the entries to extract by glob pattern. Retries with the same Idempotency-Key
+// header and archives that were ingested before respond with the job that ingested them, unless
+// the force query parameter is set.
 func (h Handler) postEvent(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	// handle
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		h.postSource(w, r)
+		return
+	}
 
-	err := unzip("./file.zip", "")
+	options, err := h.options(r)
 	if err != nil {
-		fmt.Println(err)
+		h.encoder.Error(ctx, w, err)
+		return
 	}
-	fmt.Println("received request")
 
-	h.publisher.FileCreated(ctx, "123", "/file.tsv")
-	// Empty response to Stripe with http 200 to acknowledge we handled their request.
-	h.encoder.Respond(ctx, w, struct{}{}, http.StatusOK)
-}
+	force, err := forced(r)
+	if err != nil {
+		h.encoder.Error(ctx, w, err)
+		return
+	}
 
-func unzip(source, destination string) error {
-	// 1. Open the zip file
-	reader, err := zip.OpenReader(source)
+	body, name, size, err := uploadBody(r)
 	if err != nil {
-		return err
+		h.encoder.Error(ctx, w, err)
+		return
 	}
-	defer reader.Close()
+	defer body.Close()
 
-	// 2. Get the absolute destination path
-	destination, err = filepath.Abs(destination)
+	j, duplicate, err := h.service.Create(ctx, r.Header.Get(idempotencyHeader), force)
 	if err != nil {
-		return err
+		h.encoder.Error(ctx, w, err)
+		return
+	}
+	if duplicate {
+		h.encoder.Respond(ctx, w, j, http.StatusOK)
+		return
 	}
 
-	// 3. Iterate over zip files inside the archive and unzip each of them
-	for _, f := range reader.File {
-		err := unzipFile(f, destination)
-		if err != nil {
-			return err
-		}
+	j, duplicate, err = h.service.Receive(ctx, j.ID, body, name, size, options)
+	if err != nil {
+		h.encoder.Error(ctx, w, err)
+		return
 	}
 
-	return nil
+	h.encoder.Respond(ctx, w, j, status(duplicate))
 }
 
-func unzipFile(f *zip.File, destination string) error {
-	// 4. Check if file paths are not vulnerable to Zip Slip
-	filePath := filepath.Join(destination, f.Name)
-	if !strings.HasPrefix(filePath, filepath.Clean(destination)+string(os.PathSeparator)) {
-		return fmt.Errorf("invalid file path: %s", filePath)
+// postSource creates a job downloading the archive from the URL in the request body.
+func (h Handler) postSource(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req sourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.encoder.Error(ctx, w, fmt.Errorf("failed to decode request: %v: %w", err, domain.ErrBadRequest))
+		return
 	}
 
-	// 5. Create directory tree
-	if f.FileInfo().IsDir() {
-		if err := os.MkdirAll(filePath, os.ModePerm); err != nil {
-			return err
-		}
-		return nil
+	source, err := url.Parse(req.URL)
+	if err != nil || (source.Scheme != "http" && source.Scheme != "https" && source.Scheme != "file") {
+		h.encoder.Error(ctx, w, fmt.Errorf("url must be an http(s) or file URL, got %q: %w", req.URL, domain.ErrBadRequest))
+		return
+	}
+
+	options, err := h.service.Options(req.Dataset, extractor.Options{
+		Password: req.Password,
+		Include:  req.Include,
+		Exclude:  req.Exclude,
+	})
+	if err != nil {
+		h.encoder.Error(ctx, w, err)
+		return
+	}
+
+	j, duplicate, err := h.service.Create(ctx, r.Header.Get(idempotencyHeader), req.Force)
+	if err != nil {
+		h.encoder.Error(ctx, w, err)
+		return
 	}
+	if duplicate {
+		h.encoder.Respond(ctx, w, j, http.StatusOK)
+		return
+	}
+
+	// The request context is cancelled as soon as we respond, so the download gets its own.
+	go h.service.Fetch(context.Background(), j.ID, source.String(), fileName(path.Base(source.Path)), req.SHA256, options)
+
+	h.encoder.Respond(ctx, w, j, http.StatusAccepted)
+}
 
-	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
-		return err
+// options returns the extraction options of an upload request, taken from the password header
+// and the dataset, include and exclude query parameters.
+func (h Handler) options(r *http.Request) (extractor.Options, error) {
+	query := r.URL.Query()
+	return h.service.Options(query.Get("dataset"), extractor.Options{
+		Password: r.Header.Get(passwordHeader),
+		Include:  query["include"],
+		Exclude:  query["exclude"],
+	})
+}
+
+// forced returns the force query parameter, which makes archives be ingested again.
+func forced(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("force")
+	if value == "" {
+		return false, nil
 	}
 
-	// 6. Create a destination file for unzipped content
-	destinationFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+	force, err := strconv.ParseBool(value)
 	if err != nil {
-		return err
+		return false, fmt.Errorf("invalid force parameter %q: %w", value, domain.ErrBadRequest)
+	}
+	return force, nil
+}
+
+// status returns the status code of a request that created a job, requests
+// answered with the job of an earlier request did not create anything.
+func status(duplicate bool) int {
+	if duplicate {
+		return http.StatusOK
 	}
-	defer destinationFile.Close()
+	return http.StatusAccepted
+}
 
-	// 7. Unzip the content of a file and copy it to the destination file
-	zippedFile, err := f.Open()
+// getJob responds with the current state of a job.
+func (h Handler) getJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	j, err := h.service.Job(ctx, chi.URLParam(r, "id"))
 	if err != nil {
-		return err
+		h.encoder.Error(ctx, w, err)
+		return
 	}
-	defer zippedFile.Close()
 
-	if _, err := io.Copy(destinationFile, zippedFile); err != nil {
-		return err
+	h.encoder.Respond(ctx, w, j, http.StatusOK)
+}
+
+// uploadBody returns the archive content of the request, its file name and its size, -1 when unknown.
+// The content is either the file part of a multipart form or the raw request body, named by the
+// optional name query parameter.
+func uploadBody(r *http.Request) (io.ReadCloser, string, int64, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, fileName(r.URL.Query().Get("name")), r.ContentLength, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to read multipart form: %v: %w", err, domain.ErrBadRequest)
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, "", 0, fmt.Errorf("missing form field %q: %w", formField, domain.ErrBadRequest)
+		}
+		if err != nil {
+			return nil, "", 0, fmt.Errorf("failed to read multipart form: %v: %w", err, domain.ErrBadRequest)
+		}
+
+		if part.FormName() == formField {
+			return part, fileName(part.FileName()), -1, nil
+		}
+		part.Close()
+	}
+}
+
+// fileName returns the base of the client supplied name, falling back to a default name.
+func fileName(name string) string {
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "/" || name == "." {
+		return archiveName
 	}
-	return nil
+	return name
 }
@@ -0,0 +1,162 @@
+package unzipper
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// tusVersion is the version of the tus resumable upload protocol the upload routes follow.
+	tusVersion = "1.0.0"
+
+	// chunkContentType is the content type of the chunks of a resumable upload.
+	chunkContentType = "application/offset+octet-stream"
+)
+
+// uploadRoutes serves resumable uploads: an upload is created with its size, its chunks are sent
+// with their offset, the offset to resume from can be asked for and the complete archive is processed
+// once the upload is finished. It follows the core of the tus protocol.
+func (h Handler) uploadRoutes(r chi.Router) {
+	r.Post("/", h.createUpload)
+	r.Head("/{id}", h.headUpload)
+	r.Patch("/{id}", h.patchUpload)
+	r.Delete("/{id}", h.deleteUpload)
+	r.Post("/{id}/finish", h.finishUpload)
+}
+
+// createUpload creates an upload of Upload-Length bytes. The archive is named by the filename of the
+// Upload-Metadata header or by the name query parameter.
+func (h Handler) createUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		h.encoder.Error(ctx, w, fmt.Errorf("invalid Upload-Length header: %v: %w", err, domain.ErrBadRequest))
+		return
+	}
+
+	name := metadata(r.Header.Get("Upload-Metadata"))["filename"]
+	if name == "" {
+		name = r.URL.Query().Get("name")
+	}
+
+	u, err := h.service.CreateUpload(ctx, fileName(name), size)
+	if err != nil {
+		h.encoder.Error(ctx, w, err)
+		return
+	}
+
+	w.Header().Set("Location", path.Join(r.URL.Path, u.ID))
+	w.Header().Set("Upload-Offset", "0")
+	h.encoder.Respond(ctx, w, u, http.StatusCreated)
+}
+
+// headUpload responds with the offset the upload has to be resumed from.
+func (h Handler) headUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+
+	u, err := h.service.Upload(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		h.encoder.Error(ctx, w, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Size, 10))
+	h.encoder.Respond(ctx, w, nil, http.StatusOK)
+}
+
+// patchUpload appends the request body to the upload, Upload-Offset has to be the current offset.
+func (h Handler) patchUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != chunkContentType {
+		h.encoder.Error(ctx, w, fmt.Errorf("chunks must have content type %s: %w", chunkContentType, domain.ErrBadRequest))
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		h.encoder.Error(ctx, w, fmt.Errorf("invalid Upload-Offset header: %v: %w", err, domain.ErrBadRequest))
+		return
+	}
+
+	u, err := h.service.WriteUpload(ctx, chi.URLParam(r, "id"), offset, r.Body)
+	if err != nil {
+		h.encoder.Error(ctx, w, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	h.encoder.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// deleteUpload cancels the upload.
+func (h Handler) deleteUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if err := h.service.DeleteUpload(ctx, chi.URLParam(r, "id")); err != nil {
+		h.encoder.Error(ctx, w, err)
+		return
+	}
+
+	h.encoder.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// finishUpload processes the archive of a complete upload, it takes the same
+// parameters as a single request upload. The response holds the job.
+func (h Handler) finishUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	options, err := h.options(r)
+	if err != nil {
+		h.encoder.Error(ctx, w, err)
+		return
+	}
+
+	force, err := forced(r)
+	if err != nil {
+		h.encoder.Error(ctx, w, err)
+		return
+	}
+
+	j, duplicate, err := h.service.FinishUpload(ctx, chi.URLParam(r, "id"), r.Header.Get(idempotencyHeader), force, options)
+	if err != nil {
+		h.encoder.Error(ctx, w, err)
+		return
+	}
+
+	h.encoder.Respond(ctx, w, j, status(duplicate))
+}
+
+// metadata decodes the tus Upload-Metadata header, comma separated
+// keys with base64 encoded values. Invalid pairs are ignored.
+func metadata(header string) map[string]string {
+	m := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		m[key] = string(b)
+	}
+	return m
+}
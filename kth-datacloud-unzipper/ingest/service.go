@@ -0,0 +1,422 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"github.com/amus-sal/kth-datacloud-unzipper/extractor"
+	"github.com/amus-sal/kth-datacloud-unzipper/job"
+	"github.com/google/uuid"
+)
+
+const (
+	// uploadDir is the directory inside the run directory the archive is stored in.
+	uploadDir = "upload"
+
+	// filesDir is the directory inside the run directory the archive is extracted to.
+	filesDir = "files"
+
+	// progressInterval is how often the progress of a job is saved while its archive is received.
+	progressInterval = time.Second
+)
+
+type publisher interface {
+	FileCreated(ctx context.Context, eventID string, filePath string, manifestPath string, format string) error
+}
+
+type archiveExtractor interface {
+	Extract(source, destination string, options extractor.Options) (extractor.Result, error)
+	ExtractStream(r io.Reader, name, destination string, options extractor.Options) (extractor.Result, error)
+}
+
+type downloader interface {
+	Download(ctx context.Context, source, destination, checksum string) error
+}
+
+type passwords interface {
+	Password(dataset, password string) (string, error)
+}
+
+type jobStore interface {
+	Save(ctx context.Context, j job.Job) error
+	Get(ctx context.Context, id string) (job.Job, error)
+	Claim(ctx context.Context, key, id string, replace bool) (string, error)
+}
+
+// Service ingests archives: it extracts them on the shared volume, writes their
+// manifest and publishes an event for every extracted file, tracking it all in a job.
+type Service struct {
+	publisher  publisher
+	extractor  archiveExtractor
+	downloader downloader
+	passwords  passwords
+	jobs       jobStore
+	uploads    uploadStore
+
+	// root is the directory on the shared volume where every job gets its own run directory.
+	root string
+}
+
+// NewService will return a new service with all dependencies.
+func NewService(publisher publisher, extractor archiveExtractor, downloader downloader, passwords passwords, jobs jobStore, uploads uploadStore, root string) Service {
+	return Service{
+		publisher:  publisher,
+		extractor:  extractor,
+		downloader: downloader,
+		passwords:  passwords,
+		jobs:       jobs,
+		uploads:    uploads,
+		root:       root,
+	}
+}
+
+// Create registers a new pending job and returns it. When a job was already created with the same
+// idempotency key that job is returned instead and duplicate is true, unless force is set.
+// Forced jobs also ingest archives that were ingested before.
+func (s Service) Create(ctx context.Context, idempotencyKey string, force bool) (j job.Job, duplicate bool, err error) {
+	j = job.New(uuid.NewString())
+	j.IdempotencyKey = idempotencyKey
+	j.Forced = force
+
+	if idempotencyKey != "" {
+		owner, err := s.jobs.Claim(ctx, "idempotency-key:"+idempotencyKey, j.ID, force)
+		if err != nil {
+			return job.Job{}, false, fmt.Errorf("failed to claim idempotency key: %v: %w", err, domain.ErrInternal)
+		}
+
+		if owner != j.ID {
+			original, err := s.jobs.Get(ctx, owner)
+			if errors.Is(err, domain.ErrNotFound) {
+				return job.Job{}, false, fmt.Errorf("a request with idempotency key %s is still being processed: %w", idempotencyKey, domain.ErrConflict)
+			}
+			return original, true, err
+		}
+	}
+
+	if err := s.jobs.Save(ctx, j); err != nil {
+		return job.Job{}, false, fmt.Errorf("failed to save job: %v: %w", err, domain.ErrInternal)
+	}
+	return j, false, nil
+}
+
+// Job returns the job with the given ID.
+func (s Service) Job(ctx context.Context, id string) (job.Job, error) {
+	return s.jobs.Get(ctx, id)
+}
+
+// Options completes the extraction options of a request. The password of an encrypted
+// archive is either given directly or looked up by the name of its dataset.
+func (s Service) Options(dataset string, options extractor.Options) (extractor.Options, error) {
+	password, err := s.passwords.Password(dataset, options.Password)
+	if err != nil {
+		return extractor.Options{}, err
+	}
+
+	options.Password = password
+	return options, nil
+}
+
+// UploadDir returns the directory the archive of the job should be stored in.
+func (s Service) UploadDir(id string) string {
+	return filepath.Join(s.root, id, uploadDir)
+}
+
+// Receive reads the uploaded archive of the job from body, size is its length in bytes or
+// -1 when unknown. Archives that can be extracted while they are read, such as tarballs, are
+// never stored on the shared volume. Other archives are stored and processed in the background.
+// Either way the files are published in the background, a returned error has failed the job.
+// When the archive was already ingested, the job that did so is returned and duplicate is true.
+func (s Service) Receive(ctx context.Context, id string, body io.Reader, name string, size int64, options extractor.Options) (original job.Job, duplicate bool, err error) {
+	j, err := s.jobs.Get(ctx, id)
+	if err != nil {
+		return job.Job{}, false, err
+	}
+
+	j.State = job.StateReceiving
+	j.Archive = name
+	if size > 0 {
+		j.Progress.TotalBytes = size
+	}
+	s.save(ctx, j)
+
+	// The archive is fingerprinted while it is read.
+	hash := sha256.New()
+	progress := &progressReader{r: body, ctx: ctx, service: s, job: &j}
+	br := bufio.NewReaderSize(io.TeeReader(progress, hash), extractor.HeaderSize)
+	header, err := br.Peek(extractor.HeaderSize)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("failed to read upload: %v: %w", err, domain.ErrBadRequest)
+		s.fail(ctx, j, err)
+		return job.Job{}, false, err
+	}
+
+	if !extractor.Detect(header).Streamable() {
+		archivePath, err := s.store(br, j.ID, name)
+		if err != nil {
+			s.fail(ctx, j, err)
+			return job.Job{}, false, err
+		}
+
+		if original, duplicate, err := s.deduplicate(ctx, &j, hex.EncodeToString(hash.Sum(nil))); duplicate || err != nil {
+			return original, duplicate, err
+		}
+		s.save(ctx, j)
+
+		// The request context is cancelled as soon as the upload is done, so processing gets its own.
+		go s.Process(context.Background(), j.ID, archivePath, options)
+		return j, false, nil
+	}
+
+	result, err := s.extractor.ExtractStream(br, name, filepath.Join(s.root, j.ID, filesDir), options)
+	if err != nil {
+		s.fail(ctx, j, err)
+		return job.Job{}, false, err
+	}
+
+	// Tar archives end before the end of the stream, the rest is read to fingerprint the whole archive.
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		err = fmt.Errorf("failed to read upload: %v: %w", err, domain.ErrBadRequest)
+		s.fail(ctx, j, err)
+		return job.Job{}, false, err
+	}
+
+	// The archive is already extracted by now, but its files are not announced a second time.
+	if original, duplicate, err := s.deduplicate(ctx, &j, hex.EncodeToString(hash.Sum(nil))); duplicate || err != nil {
+		return original, duplicate, err
+	}
+
+	j.State = job.StateRunning
+	s.save(ctx, j)
+
+	go s.publish(context.Background(), j, result)
+	return j, false, nil
+}
+
+// deduplicate records the fingerprint of the archive on the job. When another job that did not fail
+// ingested the same archive before, the job is marked as its duplicate, its run directory is removed and
+// the other job is returned. Forced jobs are never duplicates, they become the job of the fingerprint.
+func (s Service) deduplicate(ctx context.Context, j *job.Job, sum string) (job.Job, bool, error) {
+	j.SHA256 = sum
+	key := "sha256:" + sum
+
+	owner, err := s.jobs.Claim(ctx, key, j.ID, j.Forced)
+	if err != nil {
+		err = fmt.Errorf("failed to claim fingerprint: %v: %w", err, domain.ErrInternal)
+		s.fail(ctx, *j, err)
+		return job.Job{}, false, err
+	}
+	if owner == j.ID {
+		return *j, false, nil
+	}
+
+	// An archive whose ingestion failed, or whose job is gone, may be ingested again.
+	original, err := s.jobs.Get(ctx, owner)
+	if err != nil || original.State == job.StateFailed {
+		if _, err := s.jobs.Claim(ctx, key, j.ID, true); err != nil {
+			err = fmt.Errorf("failed to claim fingerprint: %v: %w", err, domain.ErrInternal)
+			s.fail(ctx, *j, err)
+			return job.Job{}, false, err
+		}
+		return *j, false, nil
+	}
+
+	if err := os.RemoveAll(filepath.Join(s.root, j.ID)); err != nil {
+		fmt.Println(err)
+	}
+
+	j.State = job.StateDuplicate
+	j.DuplicateOf = original.ID
+	s.save(ctx, *j)
+
+	return original, true, nil
+}
+
+// fingerprint returns the hex encoded SHA-256 of the file at path.
+func fingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// store writes the archive read from r into the upload directory of the job as name and returns its path.
+func (s Service) store(r io.Reader, id, name string) (string, error) {
+	dir := s.UploadDir(id)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create run directory: %v: %w", err, domain.ErrInternal)
+	}
+
+	// The original file name is kept since single compressed files are named after it.
+	archivePath := filepath.Join(dir, name)
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive file: %v: %w", err, domain.ErrInternal)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return "", fmt.Errorf("failed to read upload: %v: %w", err, domain.ErrBadRequest)
+	}
+
+	return archivePath, f.Close()
+}
+
+// Fetch downloads the archive of the job from the source URL as name and then processes it.
+// When checksum is set the archive has to match it. Like Process, it is meant to run in the background.
+func (s Service) Fetch(ctx context.Context, id string, source string, name string, checksum string, options extractor.Options) {
+	j, err := s.jobs.Get(ctx, id)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	j.State = job.StateDownloading
+	j.Source = source
+	s.save(ctx, j)
+
+	dir := s.UploadDir(j.ID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		s.fail(ctx, j, fmt.Errorf("failed to create run directory: %v: %w", err, domain.ErrInternal))
+		return
+	}
+
+	archivePath := filepath.Join(dir, name)
+	if err := s.downloader.Download(ctx, source, archivePath, checksum); err != nil {
+		s.fail(ctx, j, err)
+		return
+	}
+
+	sum, err := fingerprint(archivePath)
+	if err != nil {
+		s.fail(ctx, j, fmt.Errorf("failed to fingerprint archive: %v: %w", err, domain.ErrInternal))
+		return
+	}
+	if _, duplicate, err := s.deduplicate(ctx, &j, sum); duplicate || err != nil {
+		return
+	}
+	s.save(ctx, j)
+
+	s.Process(ctx, j.ID, archivePath, options)
+}
+
+// Process extracts the archive of the job and publishes its files, the outcome is recorded on the job.
+// It is meant to run in the background, so it does not return an error.
+func (s Service) Process(ctx context.Context, id string, archivePath string, options extractor.Options) {
+	j, err := s.jobs.Get(ctx, id)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	runDir := filepath.Join(s.root, j.ID)
+
+	j.State = job.StateRunning
+	j.Archive = filepath.Base(archivePath)
+	s.save(ctx, j)
+
+	result, err := s.extractor.Extract(archivePath, filepath.Join(runDir, filesDir), options)
+	if err != nil {
+		s.fail(ctx, j, err)
+		return
+	}
+
+	// The archive itself is no longer needed once it has been extracted.
+	if err := os.RemoveAll(filepath.Dir(archivePath)); err != nil {
+		fmt.Println(err)
+	}
+
+	s.publish(ctx, j, result)
+}
+
+// publish writes the manifest of the extracted files and publishes an event for every file, the outcome is recorded on the job.
+func (s Service) publish(ctx context.Context, j job.Job, result extractor.Result) {
+	runDir := filepath.Join(s.root, j.ID)
+
+	// The manifest is written next to the extracted files so downstream stages can verify them.
+	manifestPath := filepath.Join(runDir, extractor.ManifestName)
+	if err := extractor.NewManifest(j.Archive, result).Write(manifestPath); err != nil {
+		s.fail(ctx, j, fmt.Errorf("failed to write manifest: %v: %w", err, domain.ErrInternal))
+		return
+	}
+
+	j.ManifestPath = manifestPath
+	for _, file := range result.Files {
+		j.Files = append(j.Files, file.Path)
+	}
+	j.Skipped = append(j.Skipped, result.Skipped...)
+	s.save(ctx, j)
+
+	// Every file is announced even when some fail, so the job shows exactly what made it.
+	for _, file := range result.Files {
+		eventID := uuid.NewString()
+		if err := s.publisher.FileCreated(ctx, eventID, file.Path, manifestPath, string(file.Format)); err != nil {
+			j.Errors = append(j.Errors, fmt.Sprintf("failed to publish event for file = %s: %v", file.Name, err))
+			continue
+		}
+
+		j.Events = append(j.Events, job.Event{
+			EventID:  eventID,
+			FilePath: file.Path,
+			Format:   string(file.Format),
+		})
+	}
+
+	j.State = job.StateSucceeded
+	if len(j.Errors) > 0 {
+		j.State = job.StateFailed
+	}
+	s.save(ctx, j)
+}
+
+// fail records the error on the job and removes its run directory.
+func (s Service) fail(ctx context.Context, j job.Job, cause error) {
+	if err := os.RemoveAll(filepath.Join(s.root, j.ID)); err != nil {
+		fmt.Println(err)
+	}
+
+	j.Fail(cause)
+	s.save(ctx, j)
+}
+
+// progressReader counts the bytes read from the archive and saves the progress of the job every progressInterval.
+type progressReader struct {
+	r       io.Reader
+	ctx     context.Context
+	service Service
+	job     *job.Job
+	saved   time.Time
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.job.Progress.ReadBytes += int64(n)
+
+	if time.Since(p.saved) >= progressInterval {
+		p.saved = time.Now()
+		p.service.save(p.ctx, *p.job)
+	}
+	return n, err
+}
+
+// save stores the job, there is no caller to return the error to when processing in the background.
+func (s Service) save(ctx context.Context, j job.Job) {
+	if err := s.jobs.Save(ctx, j); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,111 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"github.com/amus-sal/kth-datacloud-unzipper/extractor"
+	"github.com/amus-sal/kth-datacloud-unzipper/job"
+	"github.com/amus-sal/kth-datacloud-unzipper/upload"
+)
+
+type uploadStore interface {
+	Create(ctx context.Context, name string, size int64) (upload.Upload, error)
+	Get(ctx context.Context, id string) (upload.Upload, error)
+	Write(ctx context.Context, id string, offset int64, r io.Reader) (upload.Upload, error)
+	Path(id string) (string, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// CreateUpload starts a resumable upload of an archive of size bytes named name.
+func (s Service) CreateUpload(ctx context.Context, name string, size int64) (upload.Upload, error) {
+	return s.uploads.Create(ctx, name, size)
+}
+
+// Upload returns the resumable upload with the given ID and its current offset.
+func (s Service) Upload(ctx context.Context, id string) (upload.Upload, error) {
+	return s.uploads.Get(ctx, id)
+}
+
+// WriteUpload appends a chunk starting at offset to the upload.
+func (s Service) WriteUpload(ctx context.Context, id string, offset int64, r io.Reader) (upload.Upload, error) {
+	return s.uploads.Write(ctx, id, offset, r)
+}
+
+// DeleteUpload cancels the upload and removes everything received.
+func (s Service) DeleteUpload(ctx context.Context, id string) error {
+	if _, err := s.uploads.Get(ctx, id); err != nil {
+		return err
+	}
+	return s.uploads.Delete(ctx, id)
+}
+
+// FinishUpload turns a complete upload into a job that processes the archive in the background.
+// Like Create and Receive, the job that already ingested the archive is returned for duplicates.
+func (s Service) FinishUpload(ctx context.Context, id string, idempotencyKey string, force bool, options extractor.Options) (job.Job, bool, error) {
+	u, err := s.uploads.Get(ctx, id)
+	if err != nil {
+		return job.Job{}, false, err
+	}
+	if !u.Complete() {
+		return job.Job{}, false, fmt.Errorf("upload ID = %s is incomplete, received %d of %d bytes: %w", id, u.Offset, u.Size, domain.ErrConflict)
+	}
+
+	data, err := s.uploads.Path(id)
+	if err != nil {
+		return job.Job{}, false, err
+	}
+
+	j, duplicate, err := s.Create(ctx, idempotencyKey, force)
+	if duplicate || err != nil {
+		return j, duplicate, err
+	}
+
+	j.Archive = u.Name
+	j.Progress = job.Progress{ReadBytes: u.Size, TotalBytes: u.Size}
+
+	sum, err := fingerprint(data)
+	if err != nil {
+		err = fmt.Errorf("failed to fingerprint upload ID = %s: %v: %w", id, err, domain.ErrInternal)
+		s.fail(ctx, j, err)
+		return job.Job{}, false, err
+	}
+	if original, duplicate, err := s.deduplicate(ctx, &j, sum); duplicate || err != nil {
+		if duplicate {
+			if err := s.uploads.Delete(ctx, id); err != nil {
+				fmt.Println(err)
+			}
+		}
+		return original, duplicate, err
+	}
+
+	dir := s.UploadDir(j.ID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		err = fmt.Errorf("failed to create run directory: %v: %w", err, domain.ErrInternal)
+		s.fail(ctx, j, err)
+		return job.Job{}, false, err
+	}
+
+	// Both are on the shared volume, so the archive is moved rather than copied.
+	archivePath := filepath.Join(dir, u.Name)
+	if err := os.Rename(data, archivePath); err != nil {
+		err = fmt.Errorf("failed to move upload ID = %s: %v: %w", id, err, domain.ErrConflict)
+		s.fail(ctx, j, err)
+		return job.Job{}, false, err
+	}
+
+	if err := s.uploads.Delete(ctx, id); err != nil {
+		fmt.Println(err)
+	}
+
+	s.save(ctx, j)
+
+	// The request context is cancelled as soon as we respond, so processing gets its own.
+	go s.Process(context.Background(), j.ID, archivePath, options)
+
+	return j, false, nil
+}
@@ -0,0 +1,134 @@
+package job
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"github.com/google/uuid"
+)
+
+// keysDir is the directory inside the store holding a file per claimed key.
+const keysDir = "keys"
+
+// FileStore persists every job as a JSON file in a directory, so jobs
+// survive restarts and can be read by any replica sharing the volume.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a job store writing to dir, the directory is created when missing.
+func NewFileStore(dir string) (FileStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, keysDir), os.ModePerm); err != nil {
+		return FileStore{}, err
+	}
+
+	return FileStore{
+		dir: dir,
+	}, nil
+}
+
+// Save creates or replaces the job, it is written to a temporary file first
+// so readers never see a partially written job.
+func (s FileStore) Save(ctx context.Context, j Job) error {
+	j.UpdatedAt = time.Now().UTC()
+
+	b, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job ID = %s: %v: %w", j.ID, err, domain.ErrInternal)
+	}
+
+	path, err := s.path(j.ID)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + "." + uuid.NewString() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Get returns the job with the given ID.
+func (s FileStore) Get(ctx context.Context, id string) (Job, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Job{}, fmt.Errorf("job ID = %s: %w", id, domain.ErrNotFound)
+	}
+	if err != nil {
+		return Job{}, err
+	}
+
+	var j Job
+	if err := json.Unmarshal(b, &j); err != nil {
+		return Job{}, fmt.Errorf("failed to unmarshal job ID = %s: %v: %w", id, err, domain.ErrInternal)
+	}
+	return j, nil
+}
+
+// Claim makes key refer to the job with the given ID, unless it already refers to another job.
+// It returns the ID of the job the key refers to, with replace that is always the given job.
+// Keys are claimed by exclusively creating their file, so only one replica can claim a key.
+func (s FileStore) Claim(ctx context.Context, key, id string, replace bool) (string, error) {
+	sum := sha256.Sum256([]byte(key))
+	path := filepath.Join(s.dir, keysDir, hex.EncodeToString(sum[:]))
+
+	if !replace {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			defer f.Close()
+			if _, err := f.WriteString(id); err != nil {
+				return "", err
+			}
+			return id, f.Close()
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+
+		// A key without an ID was claimed by a process that stopped before it could write it.
+		owner, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		if len(owner) > 0 {
+			return string(owner), nil
+		}
+	}
+
+	tmp := path + "." + uuid.NewString() + ".tmp"
+	if err := os.WriteFile(tmp, []byte(id), 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return id, nil
+}
+
+// path returns the file of the job, IDs are validated since they come from the URL.
+func (s FileStore) path(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", fmt.Errorf("job ID = %s: %w", id, domain.ErrNotFound)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
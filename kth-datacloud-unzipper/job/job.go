@@ -0,0 +1,100 @@
+package job
+
+import (
+	"time"
+)
+
+// State is the processing state of a job.
+type State string
+
+const (
+	// StatePending is a job whose archive has been received but not processed yet.
+	StatePending = State("pending")
+
+	// StateReceiving is a job whose archive is being uploaded, it is extracted while it is
+	// received when its format allows it.
+	StateReceiving = State("receiving")
+
+	// StateDownloading is a job whose archive is being downloaded from its source URL.
+	StateDownloading = State("downloading")
+
+	// StateRunning is a job whose archive is being extracted and announced.
+	StateRunning = State("running")
+
+	// StateSucceeded is a job where every extracted file has been announced.
+	StateSucceeded = State("succeeded")
+
+	// StateFailed is a job that stopped because of an error.
+	StateFailed = State("failed")
+
+	// StateDuplicate is a job whose archive was already ingested by the job it is a duplicate of.
+	StateDuplicate = State("duplicate")
+)
+
+// Event is a file event published for a job.
+type Event struct {
+	EventID  string `json:"event_id"`
+	FilePath string `json:"file_path"`
+	Format   string `json:"format"`
+}
+
+// Progress is the number of bytes of the archive received so far.
+type Progress struct {
+	ReadBytes int64 `json:"read_bytes"`
+
+	// TotalBytes is the size of the archive, zero when it is not known up front.
+	TotalBytes int64 `json:"total_bytes,omitempty"`
+}
+
+// Job tracks the ingestion of a single archive.
+type Job struct {
+	ID           string `json:"id"`
+	State        State  `json:"state"`
+	Source       string `json:"source,omitempty"`
+	Archive      string `json:"archive,omitempty"`
+	ManifestPath string `json:"manifest_path,omitempty"`
+
+	// SHA256 is the fingerprint of the archive, archives are only ingested once unless Forced is set.
+	SHA256         string `json:"sha256,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	Forced         bool   `json:"forced,omitempty"`
+	DuplicateOf    string `json:"duplicate_of,omitempty"`
+
+	Progress  Progress  `json:"progress"`
+	Files     []string  `json:"files"`
+	Skipped   []string  `json:"skipped"`
+	Events    []Event   `json:"events"`
+	Errors    []string  `json:"errors"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// New returns a pending job with the given ID.
+func New(id string) Job {
+	now := time.Now().UTC()
+	return Job{
+		ID:        id,
+		State:     StatePending,
+		Files:     []string{},
+		Skipped:   []string{},
+		Events:    []Event{},
+		Errors:    []string{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Fail moves the job to the failed state and records the error.
+func (j *Job) Fail(err error) {
+	j.State = StateFailed
+	j.Errors = append(j.Errors, err.Error())
+}
+
+// clone returns a copy of the job that shares no slices with the original.
+func (j Job) clone() Job {
+	j.Files = append([]string{}, j.Files...)
+	j.Skipped = append([]string{}, j.Skipped...)
+	j.Events = append([]Event{}, j.Events...)
+	j.Errors = append([]string{}, j.Errors...)
+	return j
+}
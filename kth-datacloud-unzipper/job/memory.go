@@ -0,0 +1,61 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+)
+
+// MemoryStore keeps jobs in memory, jobs are lost when the process exits.
+type MemoryStore struct {
+	jobs map[string]Job
+	keys map[string]string
+	lock sync.RWMutex
+}
+
+// NewMemoryStore returns an empty in-memory job store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs: make(map[string]Job),
+		keys: make(map[string]string),
+	}
+}
+
+// Save creates or replaces the job.
+func (s *MemoryStore) Save(ctx context.Context, j Job) error {
+	j.UpdatedAt = time.Now().UTC()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.jobs[j.ID] = j.clone()
+	return nil
+}
+
+// Get returns the job with the given ID.
+func (s *MemoryStore) Get(ctx context.Context, id string) (Job, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job ID = %s: %w", id, domain.ErrNotFound)
+	}
+	return j.clone(), nil
+}
+
+// Claim makes key refer to the job with the given ID, unless it already refers to another job.
+// It returns the ID of the job the key refers to, with replace that is always the given job.
+func (s *MemoryStore) Claim(ctx context.Context, key, id string, replace bool) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if owner, ok := s.keys[key]; ok && !replace {
+		return owner, nil
+	}
+	s.keys[key] = id
+	return id, nil
+}
@@ -0,0 +1,76 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"github.com/google/uuid"
+)
+
+type store interface {
+	Save(ctx context.Context, j Job) error
+	Get(ctx context.Context, id string) (Job, error)
+	Claim(ctx context.Context, key, id string, replace bool) (string, error)
+}
+
+func TestStore(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]store{
+		"memory": NewMemoryStore(),
+		"file":   fileStore,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.TODO()
+
+			j := New(uuid.NewString())
+			if err := s.Save(ctx, j); err != nil {
+				t.Fatal(err)
+			}
+
+			j.State = StateSucceeded
+			j.Files = append(j.Files, "/usr/file/a.tsv")
+			if err := s.Save(ctx, j); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := s.Get(ctx, j.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.State != StateSucceeded || len(got.Files) != 1 {
+				t.Errorf("expected job to be = %+v, got = %+v", j, got)
+			}
+
+			if _, err := s.Get(ctx, uuid.NewString()); !errors.Is(err, domain.ErrNotFound) {
+				t.Errorf("expected error to be = %v, got = %v", domain.ErrNotFound, err)
+			}
+
+			other := uuid.NewString()
+			for _, claim := range []struct {
+				id       string
+				replace  bool
+				expected string
+			}{
+				{id: j.ID, expected: j.ID},
+				{id: other, expected: j.ID},
+				{id: other, replace: true, expected: other},
+			} {
+				owner, err := s.Claim(ctx, "sha256:abc", claim.id, claim.replace)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if owner != claim.expected {
+					t.Errorf("expected key to be claimed by = %s, got = %s", claim.expected, owner)
+				}
+			}
+		})
+	}
+}
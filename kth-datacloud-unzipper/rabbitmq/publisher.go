@@ -105,16 +105,37 @@ func (p *Publisher) Close() {
 	})
 }
 
+// quarantineRoutingKey is used for files of a format no pipeline stage can handle.
+const quarantineRoutingKey = "file.quarantined"
+
+// routingKeys maps the sniffed format of a file to the pipeline stage that handles it.
+// Delimited text other than comma separated, such as the semicolon separated text of Excel,
+// goes through the converter the same way TSV does.
+var routingKeys = map[string]string{
+	"tsv":       "tsv.created",
+	"delimited": "tsv.created",
+	"csv":       "csv.created",
+	"json":      "json.created",
+	"xlsx":      "spreadsheet.created",
+	"ods":       "spreadsheet.created",
+}
+
 type FileEvent struct {
-	EventID  string `json:"event_id"`
-	FilePath string `json:"file_path"`
+	EventID      string `json:"event_id"`
+	FilePath     string `json:"file_path"`
+	ManifestPath string `json:"manifest_path,omitempty"`
+	Format       string `json:"format"`
 }
 
-// PurchaseSucceeded will publish the event when a purchase has succeeded.
-func (p *Publisher) FileCreated(ctx context.Context, eventID string, filePath string) error {
+// FileCreated will publish the event when a file has been extracted, manifestPath
+// points to the manifest of the archive the file was extracted from. The routing
+// key is chosen from the format so the file skips stages it does not need.
+func (p *Publisher) FileCreated(ctx context.Context, eventID string, filePath string, manifestPath string, format string) error {
 	payload := FileEvent{
-		EventID:  eventID,
-		FilePath: filePath,
+		EventID:      eventID,
+		FilePath:     filePath,
+		ManifestPath: manifestPath,
+		Format:       format,
 	}
 
 	fmt.Println("get file")
@@ -123,7 +144,12 @@ func (p *Publisher) FileCreated(ctx context.Context, eventID string, filePath st
 		return fmt.Errorf("failed to marshal payload for event ID = %s: %w", eventID, domain.ErrBadRequest)
 	}
 
-	return p.publish(ctx, "tsv.created", bytes)
+	routingKey, ok := routingKeys[format]
+	if !ok {
+		routingKey = quarantineRoutingKey
+	}
+
+	return p.publish(ctx, routingKey, bytes)
 }
 
 // Publish will publish the message on the given exchange.
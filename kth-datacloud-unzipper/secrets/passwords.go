@@ -0,0 +1,51 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+)
+
+// Passwords looks up the passwords of encrypted archives by dataset name. The secrets file
+// is a JSON object mapping dataset names to passwords, it is read on every lookup so
+// rotated secrets are picked up without a restart.
+type Passwords struct {
+	path string
+}
+
+// NewPasswords returns passwords read from the secrets file at path.
+func NewPasswords(path string) Passwords {
+	return Passwords{
+		path: path,
+	}
+}
+
+// Password returns password when it is set, otherwise the password of the dataset.
+// It returns an empty password when neither is given.
+func (p Passwords) Password(dataset, password string) (string, error) {
+	if password != "" || dataset == "" {
+		return password, nil
+	}
+
+	b, err := os.ReadFile(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("no password for dataset %s, secrets file %s does not exist: %w", dataset, p.path, domain.ErrBadRequest)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secrets file: %v: %w", err, domain.ErrInternal)
+	}
+
+	var passwords map[string]string
+	if err := json.Unmarshal(b, &passwords); err != nil {
+		return "", fmt.Errorf("failed to decode secrets file: %v: %w", err, domain.ErrInternal)
+	}
+
+	password, ok := passwords[dataset]
+	if !ok {
+		return "", fmt.Errorf("no password for dataset %s: %w", dataset, domain.ErrBadRequest)
+	}
+	return password, nil
+}
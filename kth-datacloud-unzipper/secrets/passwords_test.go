@@ -0,0 +1,68 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+)
+
+func TestPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive-secrets.json")
+	if err := os.WriteFile(path, []byte(`{"partner-sales": "secret"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		path             string
+		dataset          string
+		password         string
+		expectedPassword string
+		expectedErr      error
+	}{
+		{
+			name:             "password of the request",
+			path:             path,
+			dataset:          "partner-sales",
+			password:         "override",
+			expectedPassword: "override",
+		},
+		{
+			name:             "password of the dataset",
+			path:             path,
+			dataset:          "partner-sales",
+			expectedPassword: "secret",
+		},
+		{
+			name: "no password",
+			path: path,
+		},
+		{
+			name:        "unknown dataset",
+			path:        path,
+			dataset:     "partner-orders",
+			expectedErr: domain.ErrBadRequest,
+		},
+		{
+			name:        "missing secrets file",
+			path:        filepath.Join(t.TempDir(), "missing.json"),
+			dataset:     "partner-sales",
+			expectedErr: domain.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			password, err := NewPasswords(tt.path).Password(tt.dataset, tt.password)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("expected error to be = %v, got = %v", tt.expectedErr, err)
+			}
+			if password != tt.expectedPassword {
+				t.Errorf("expected password to be = %q, got = %q", tt.expectedPassword, password)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package sniffer
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// Format is the data format of a file, detected from its content.
+type Format string
+
+const (
+	// FormatUnknown is any content that is not one of the formats below.
+	FormatUnknown = Format("unknown")
+
+	// FormatTSV is tab separated text.
+	FormatTSV = Format("tsv")
+
+	// FormatCSV is comma separated text.
+	FormatCSV = Format("csv")
+
+	// FormatDelimited is text separated by another delimiter, such as a semicolon or a pipe.
+	FormatDelimited = Format("delimited")
+
+	// FormatJSON is a JSON document or a stream of newline delimited JSON documents.
+	FormatJSON = Format("json")
+
+	// FormatXLSX is an Office Open XML spreadsheet.
+	FormatXLSX = Format("xlsx")
+
+	// FormatODS is an OpenDocument spreadsheet.
+	FormatODS = Format("ods")
+)
+
+// SampleSize is the number of bytes from the start of a file needed to detect its format.
+const SampleSize = 8 << 10 // 8 KiB.
+
+// maxLines is the maximum number of lines of the sample used to detect the delimiter.
+const maxLines = 20
+
+var (
+	zipMagic    = []byte("PK\x03\x04")
+	odsMimeType = []byte("application/vnd.oasis.opendocument.spreadsheet")
+	xlsxEntries = [][]byte{[]byte("[Content_Types].xml"), []byte("xl/")}
+
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+// delimiters are the candidate delimiters in order of preference.
+var delimiters = []struct {
+	delimiter byte
+	format    Format
+}{
+	{'\t', FormatTSV},
+	{',', FormatCSV},
+	{';', FormatDelimited},
+	{'|', FormatDelimited},
+}
+
+// Detect returns the format of a file starting with sample, complete tells
+// whether the sample is the entire file or was cut off at SampleSize.
+func Detect(sample []byte, complete bool) Format {
+	if bytes.HasPrefix(sample, zipMagic) {
+		return detectSpreadsheet(sample)
+	}
+
+	switch {
+	case bytes.HasPrefix(sample, utf8BOM):
+		sample = sample[len(utf8BOM):]
+	case bytes.HasPrefix(sample, utf16LEBOM), bytes.HasPrefix(sample, utf16BEBOM):
+		// Good enough to look at the delimiters, the converter takes care of the encoding.
+		sample = bytes.ReplaceAll(sample[len(utf16LEBOM):], []byte{0}, nil)
+	}
+
+	if !isText(sample) {
+		return FormatUnknown
+	}
+
+	trimmed := bytes.TrimLeft(sample, " \t\r\n")
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return FormatJSON
+	}
+
+	lines := bytes.Split(sample, []byte("\n"))
+	if !complete && len(lines) > 1 {
+		// The last line was most likely cut off by the sample size.
+		lines = lines[:len(lines)-1]
+	}
+
+	var rows [][]byte
+	for _, line := range lines {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+		rows = append(rows, line)
+		if len(rows) == maxLines {
+			break
+		}
+	}
+
+	if len(rows) == 0 {
+		return FormatUnknown
+	}
+
+	format, best := FormatUnknown, 0
+	for _, d := range delimiters {
+		if n := consistentCount(rows, d.delimiter); n > best {
+			format, best = d.format, n
+		}
+	}
+
+	return format
+}
+
+// consistentCount returns the number of times delimiter occurs outside of quotes on every row,
+// or zero when rows have a different number of delimiters.
+func consistentCount(rows [][]byte, delimiter byte) int {
+	count := -1
+	for _, row := range rows {
+		n, quoted := 0, false
+		for _, c := range row {
+			switch {
+			case c == '"':
+				quoted = !quoted
+			case c == delimiter && !quoted:
+				n++
+			}
+		}
+
+		if count != -1 && n != count {
+			return 0
+		}
+		count = n
+	}
+
+	return count
+}
+
+// isText reports whether the sample looks like text in an ASCII compatible encoding.
+func isText(sample []byte) bool {
+	if len(sample) == 0 || bytes.IndexByte(sample, 0) != -1 {
+		return false
+	}
+
+	// Allow a rune cut off at the end of the sample, and latin-1 like
+	// encodings which are not valid UTF-8 but still readable text.
+	control := 0
+	for len(sample) > 0 {
+		r, size := utf8.DecodeRune(sample)
+		if r < ' ' && r != '\t' && r != '\n' && r != '\r' && r != '\f' {
+			control++
+		}
+		sample = sample[size:]
+	}
+
+	return control == 0
+}
+
+// detectSpreadsheet tells spreadsheets apart from other zip based files by their first entries.
+func detectSpreadsheet(sample []byte) Format {
+	if bytes.Contains(sample, odsMimeType) {
+		return FormatODS
+	}
+
+	for _, entry := range xlsxEntries {
+		if !bytes.Contains(sample, entry) {
+			return FormatUnknown
+		}
+	}
+
+	return FormatXLSX
+}
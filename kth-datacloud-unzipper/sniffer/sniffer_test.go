@@ -0,0 +1,95 @@
+package sniffer
+
+import (
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		sample   string
+		complete bool
+		expected Format
+	}{
+		{
+			name:     "tsv",
+			sample:   "Name\tText\tStart\nDescribe\tnormal\t175\n",
+			complete: true,
+			expected: FormatTSV,
+		},
+		{
+			name:     "csv",
+			sample:   "name,city\n\"Doe, John\",Stockholm\n",
+			complete: true,
+			expected: FormatCSV,
+		},
+		{
+			name:     "semicolon separated from swedish excel",
+			sample:   "\xef\xbb\xbfnamn;stad;belopp\nÅsa;Göteborg;12,50\nÖrjan;Malmö;3,00\n",
+			complete: true,
+			expected: FormatDelimited,
+		},
+		{
+			name:     "pipe separated",
+			sample:   "a|b|c\n1|2|3\n",
+			complete: true,
+			expected: FormatDelimited,
+		},
+		{
+			name:     "cut off last line is ignored",
+			sample:   "a\tb\n1\t2\n3",
+			complete: false,
+			expected: FormatTSV,
+		},
+		{
+			name:     "json document",
+			sample:   "  {\"name\": \"a\"}",
+			complete: true,
+			expected: FormatJSON,
+		},
+		{
+			name:     "ndjson",
+			sample:   "{\"a\":1}\n{\"a\":2}\n",
+			complete: true,
+			expected: FormatJSON,
+		},
+		{
+			name:     "xlsx",
+			sample:   "PK\x03\x04\x14\x00[Content_Types].xml...PK\x03\x04xl/workbook.xml",
+			complete: false,
+			expected: FormatXLSX,
+		},
+		{
+			name:     "ods",
+			sample:   "PK\x03\x04\x14\x00mimetypeapplication/vnd.oasis.opendocument.spreadsheetPK",
+			complete: false,
+			expected: FormatODS,
+		},
+		{
+			name:     "other zip based file",
+			sample:   "PK\x03\x04\x14\x00word/document.xml",
+			complete: false,
+			expected: FormatUnknown,
+		},
+		{
+			name:     "binary",
+			sample:   "\x89PNG\r\n\x1a\n\x00\x00",
+			complete: true,
+			expected: FormatUnknown,
+		},
+		{
+			name:     "prose",
+			sample:   "This dataset contains\nall the things.\n",
+			complete: true,
+			expected: FormatUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect([]byte(tt.sample), tt.complete); got != tt.expected {
+				t.Errorf("expected format to be = %s, got = %s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"github.com/google/uuid"
+)
+
+const (
+	// infoName is the file in the directory of an upload describing it.
+	infoName = "info.json"
+
+	// dataName is the file in the directory of an upload holding the bytes received so far.
+	dataName = "data"
+)
+
+// Upload is an archive that is uploaded in chunks.
+type Upload struct {
+	ID string `json:"id"`
+
+	// Name is the file name of the archive.
+	Name string `json:"name"`
+
+	// Size is the total size of the archive in bytes.
+	Size int64 `json:"size"`
+
+	// Offset is the number of bytes received so far.
+	Offset int64 `json:"offset"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Complete reports whether all bytes of the archive have been received.
+func (u Upload) Complete() bool {
+	return u.Offset == u.Size
+}
+
+// Store keeps uploads in progress on the shared volume. The offset of an upload is the size of its
+// data file, so an upload can be resumed after client disconnects and server restarts.
+type Store struct {
+	dir string
+
+	// maxBytes is the maximum size of an upload, zero means unlimited.
+	maxBytes int64
+
+	// writing holds a mutex per upload, so chunks of the same upload are never written concurrently.
+	writing *sync.Map
+}
+
+// NewStore returns an upload store writing to dir, the directory is created when missing.
+func NewStore(dir string, maxBytes int64) (Store, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return Store{}, err
+	}
+
+	return Store{
+		dir:      dir,
+		maxBytes: maxBytes,
+		writing:  &sync.Map{},
+	}, nil
+}
+
+// Create registers a new upload of an archive of size bytes.
+func (s Store) Create(ctx context.Context, name string, size int64) (Upload, error) {
+	if size <= 0 {
+		return Upload{}, fmt.Errorf("upload size must be positive, got %d: %w", size, domain.ErrBadRequest)
+	}
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return Upload{}, fmt.Errorf("upload is larger than %d bytes: %w", s.maxBytes, domain.ErrTooLarge)
+	}
+
+	u := Upload{
+		ID:        uuid.NewString(),
+		Name:      name,
+		Size:      size,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	dir := filepath.Join(s.dir, u.ID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return Upload{}, err
+	}
+
+	b, err := json.Marshal(u)
+	if err != nil {
+		return Upload{}, fmt.Errorf("failed to marshal upload ID = %s: %v: %w", u.ID, err, domain.ErrInternal)
+	}
+
+	// The data file is created first, an upload is only visible once its info exists.
+	if err := os.WriteFile(filepath.Join(dir, dataName), nil, 0644); err != nil {
+		return Upload{}, err
+	}
+
+	tmp := filepath.Join(dir, infoName+".tmp")
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return Upload{}, err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, infoName)); err != nil {
+		return Upload{}, err
+	}
+
+	return u, nil
+}
+
+// Get returns the upload with the given ID and its current offset.
+func (s Store) Get(ctx context.Context, id string) (Upload, error) {
+	dir, err := s.path(id)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, infoName))
+	if errors.Is(err, os.ErrNotExist) {
+		return Upload{}, fmt.Errorf("upload ID = %s: %w", id, domain.ErrNotFound)
+	}
+	if err != nil {
+		return Upload{}, err
+	}
+
+	var u Upload
+	if err := json.Unmarshal(b, &u); err != nil {
+		return Upload{}, fmt.Errorf("failed to unmarshal upload ID = %s: %v: %w", id, err, domain.ErrInternal)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, dataName))
+	if errors.Is(err, os.ErrNotExist) {
+		return Upload{}, fmt.Errorf("upload ID = %s: %w", id, domain.ErrNotFound)
+	}
+	if err != nil {
+		return Upload{}, err
+	}
+
+	u.Offset = info.Size()
+	return u, nil
+}
+
+// Write appends the chunk read from r to the upload. The offset has to be the current offset of
+// the upload, otherwise the client is out of sync and has to ask for the offset first. Everything
+// read before r fails is kept, so the upload can be resumed from there.
+func (s Store) Write(ctx context.Context, id string, offset int64, r io.Reader) (Upload, error) {
+	// The upload is looked up before taking its mutex, so no mutexes are kept for unknown IDs.
+	if _, err := s.Get(ctx, id); err != nil {
+		return Upload{}, err
+	}
+
+	mu, _ := s.writing.LoadOrStore(id, &sync.Mutex{})
+	if !mu.(*sync.Mutex).TryLock() {
+		return Upload{}, fmt.Errorf("upload ID = %s is being written by another request: %w", id, domain.ErrConflict)
+	}
+	defer mu.(*sync.Mutex).Unlock()
+
+	// The offset is read again, another request may have written a chunk in the meantime.
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return Upload{}, err
+	}
+
+	if offset != u.Offset {
+		return u, fmt.Errorf("upload ID = %s is at offset %d, got %d: %w", id, u.Offset, offset, domain.ErrConflict)
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.dir, id, dataName), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return u, err
+	}
+	defer f.Close()
+
+	// One byte more than missing is read to tell whether the chunk goes past the size of the upload.
+	n, err := io.Copy(f, io.LimitReader(r, u.Size-u.Offset+1))
+	if n > u.Size-u.Offset {
+		if err := f.Truncate(u.Size); err != nil {
+			return u, err
+		}
+		n = u.Size - u.Offset
+		err = fmt.Errorf("upload ID = %s is larger than its size of %d bytes: %w", id, u.Size, domain.ErrBadRequest)
+	}
+	u.Offset += n
+	if u.Complete() {
+		// No more chunks are expected, the mutex is not kept until the upload is removed.
+		s.writing.Delete(id)
+	}
+
+	// The received bytes are synced even when reading failed, they are the offset the client resumes from.
+	if serr := f.Sync(); serr != nil && err == nil {
+		err = serr
+	}
+	if err != nil && !errors.Is(err, domain.ErrBadRequest) {
+		err = fmt.Errorf("failed to read chunk of upload ID = %s: %v: %w", id, err, domain.ErrBadRequest)
+	}
+	return u, err
+}
+
+// Path returns the file holding the bytes of the upload.
+func (s Store) Path(id string) (string, error) {
+	dir, err := s.path(id)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, dataName), nil
+}
+
+// Delete removes the upload and everything received.
+func (s Store) Delete(ctx context.Context, id string) error {
+	dir, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	s.writing.Delete(id)
+	return os.RemoveAll(dir)
+}
+
+// path returns the directory of the upload, IDs are validated since they come from the URL.
+func (s Store) path(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", fmt.Errorf("upload ID = %s: %w", id, domain.ErrNotFound)
+	}
+	return filepath.Join(s.dir, id), nil
+}
@@ -0,0 +1,124 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/amus-sal/kth-datacloud-unzipper/domain"
+	"github.com/google/uuid"
+)
+
+// brokenReader returns its content and then fails like a dropped connection.
+type brokenReader struct {
+	r io.Reader
+}
+
+func (b brokenReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// mutexes returns the number of uploads the store holds a mutex for.
+func mutexes(s Store) int {
+	n := 0
+	s.writing.Range(func(key, value interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.TODO()
+	dir := t.TempDir()
+
+	s, err := NewStore(dir, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Create(ctx, "archive.tgz", 17); !errors.Is(err, domain.ErrTooLarge) {
+		t.Errorf("expected error to be = %v, got = %v", domain.ErrTooLarge, err)
+	}
+
+	u, err := s.Create(ctx, "archive.tgz", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first chunk is interrupted, what was received is kept.
+	if _, err := s.Write(ctx, u.ID, 0, brokenReader{strings.NewReader("0123")}); !errors.Is(err, domain.ErrBadRequest) {
+		t.Errorf("expected error to be = %v, got = %v", domain.ErrBadRequest, err)
+	}
+
+	// A new store on the same directory resumes the upload, like after a restart.
+	s, err = NewStore(dir, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Offset != 4 || got.Complete() {
+		t.Errorf("expected offset to be = 4, got = %d", got.Offset)
+	}
+
+	if _, err := s.Write(ctx, u.ID, 0, strings.NewReader("0123")); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("expected error to be = %v, got = %v", domain.ErrConflict, err)
+	}
+
+	if _, err := s.Write(ctx, u.ID, 4, strings.NewReader("456789abc")); !errors.Is(err, domain.ErrBadRequest) {
+		t.Errorf("expected error to be = %v, got = %v", domain.ErrBadRequest, err)
+	}
+
+	got, err = s.Get(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Complete() {
+		t.Errorf("expected upload to be complete, got offset = %d", got.Offset)
+	}
+	if n := mutexes(s); n != 0 {
+		t.Errorf("expected no mutexes to be kept for the complete upload, got = %d", n)
+	}
+
+	path, err := s.Path(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, []byte("0123456789")) {
+		t.Errorf("expected content to be = %q, got = %q", "0123456789", b)
+	}
+
+	if err := s.Delete(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, u.ID); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("expected error to be = %v, got = %v", domain.ErrNotFound, err)
+	}
+	if _, err := s.Get(ctx, uuid.NewString()); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("expected error to be = %v, got = %v", domain.ErrNotFound, err)
+	}
+	for _, id := range []string{uuid.NewString(), "../" + u.ID} {
+		if _, err := s.Write(ctx, id, 0, strings.NewReader("0")); !errors.Is(err, domain.ErrNotFound) {
+			t.Errorf("expected error to be = %v, got = %v", domain.ErrNotFound, err)
+		}
+	}
+	if n := mutexes(s); n != 0 {
+		t.Errorf("expected no mutexes to be kept for unknown uploads, got = %d", n)
+	}
+}